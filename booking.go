@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+type BookingStatus string
+
+const (
+	BookingConfirmed BookingStatus = "Confirmed"
+	BookingCancelled BookingStatus = "Cancelled"
+	BookingNoShow    BookingStatus = "No Show"
+)
+
+// Booking records a passenger's seats on one ride, or on every leg of an
+// indirect route.
+type Booking struct {
+	ID              string
+	PassengerID     string
+	Legs            []Ride // rides as they were when booked, in travel order
+	Transfers       []Transfer
+	JourneyTime     time.Duration // first departure to last arrival; zero if any leg is unscheduled
+	Seats           int
+	LegFares        []float64 // per seat on each leg; split-cost legs follow the current share
+	Price           float64   // for all seats
+	SurgeMultiplier float64   // demand multiplier included in scheduled leg fares, kept for audit
+	Status          BookingStatus
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+
+	CancelledAt        time.Time
+	CancellationReason string
+	CancellationFee    float64 // forfeited from Price when cancelled or a no-show
+	DroppedLegs        []Ride  // refunded after a driver cancelled them mid-journey
+}
+
+// RideIDs returns the IDs of the booked rides in travel order.
+func (b Booking) RideIDs() []string {
+	ids := make([]string, len(b.Legs))
+	for i, leg := range b.Legs {
+		ids[i] = leg.ID
+	}
+	return ids
+}
+
+// Share returns what each passenger on the booking pays for their seat.
+func (b Booking) Share() float64 {
+	var share float64
+	for _, fare := range b.LegFares {
+		share = roundFare(share + fare)
+	}
+	return share
+}
+
+// price totals the leg fares for every seat, as itineraries do.
+func (b Booking) price() float64 {
+	var price float64
+	for _, fare := range b.LegFares {
+		price = roundFare(price + fare*float64(b.Seats))
+	}
+	return price
+}
+
+func (b Booking) printConfirmation() {
+	fmt.Printf("Booking confirmed: %v for %d seat(s), %.2f per passenger, %.2f in total\n", b.ID, b.Seats, b.Share(), b.Price)
+}
+
+// createBooking charges the passenger and records a confirmed booking for the
+// seats of it, already reserved on legs, at the fares it was quoted, then
+// shares the cost of any split-cost leg again now one more passenger is on it,
+// cancelling the booking if that fails. It holds bookingMu throughout so a
+// ride cancelled after its seats were reserved is not booked.
+func (rm *rideManager) createBooking(passengerID string, legs []Ride, it Itinerary) (Booking, error) {
+	rm.bookingMu.Lock()
+	defer rm.bookingMu.Unlock()
+	for _, leg := range legs {
+		ride, err := rm.storage.GetRideByID(leg.ID)
+		if err != nil {
+			return Booking{}, fmt.Errorf("could not find ride %s: %v", leg.ID, err)
+		}
+		if !ride.Status.AcceptsBookings() {
+			return Booking{}, fmt.Errorf("ride %s is %s", leg.ID, ride.Status)
+		}
+	}
+	now := rm.now()
+	journeyTime, transfers := journeyTiming(legs)
+	fares := make([]float64, len(it.Legs))
+	for i, leg := range it.Legs {
+		fares[i] = leg.Fare
+	}
+	booking := Booking{
+		ID:              fmt.Sprintf("B%d", rm.bookingSeq.Add(1)),
+		PassengerID:     passengerID,
+		Legs:            legs,
+		Transfers:       transfers,
+		JourneyTime:     journeyTime,
+		Seats:           it.Seats,
+		LegFares:        fares,
+		Price:           it.Price,
+		SurgeMultiplier: it.SurgeMultiplier,
+		Status:          BookingConfirmed,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := rm.chargeBooking(booking); err != nil {
+		return Booking{}, fmt.Errorf("could not charge booking: %v", err)
+	}
+	if err := rm.bookings.AddBooking(booking); err != nil {
+		if rfErr := rm.refundBooking(booking, booking.amount(), "booking not recorded"); rfErr != nil {
+			return Booking{}, fmt.Errorf("could not record booking: %v; refund failed: %v", err, rfErr)
+		}
+		return Booking{}, fmt.Errorf("could not record booking: %v", err)
+	}
+	if !driverPriced(legs) {
+		return booking, nil
+	}
+	if err := rm.updateCostShares(legs); err != nil {
+		// The booking was priced at the new share, so it can't stand while
+		// the other passengers keep the old one.
+		booking.Status = BookingCancelled
+		booking.CancelledAt = rm.now()
+		booking.CancellationReason = "cost shares not updated"
+		if ucErr := rm.bookings.UpdateBooking(booking); ucErr != nil {
+			return Booking{}, fmt.Errorf("could not share costs: %v; cancelling booking failed: %v", err, ucErr)
+		}
+		if rfErr := rm.refundBooking(booking, booking.amount(), booking.CancellationReason); rfErr != nil {
+			return Booking{}, fmt.Errorf("could not share costs: %v; refund failed: %v", err, rfErr)
+		}
+		return Booking{}, fmt.Errorf("could not share costs: %v", err)
+	}
+	if updated, err := rm.bookings.GetBookingByID(booking.ID); err == nil {
+		booking = updated
+	}
+	return booking, nil
+}
+
+func (rm *rideManager) GetBookingByID(bookingID string) (Booking, error) {
+	booking, err := rm.bookings.GetBookingByID(bookingID)
+	if err != nil {
+		return Booking{}, fmt.Errorf("could not find booking %s: %v", bookingID, err)
+	}
+	return booking, nil
+}
+
+// GetBookingsByRide retrieves all bookings that include a ride, i.e. the
+// passengers on it.
+func (rm *rideManager) GetBookingsByRide(rideID string) []Booking {
+	return rm.bookings.GetBookingsByRide(rideID)
+}
+
+// GetBookingsByPassenger retrieves all bookings made by a passenger.
+func (rm *rideManager) GetBookingsByPassenger(passengerID string) []Booking {
+	return rm.bookings.GetBookingsByPassenger(passengerID)
+}
+
+// SetCancellationWindow stops passengers cancelling within window of their
+// first ride's departure. Zero, the default, allows cancelling at any time
+// before the rides start, as does a ride without a departure time.
+func (rm *rideManager) SetCancellationWindow(window time.Duration) {
+	rm.bookingMu.Lock()
+	defer rm.bookingMu.Unlock()
+	rm.cancelWindow = window
+}
+
+// CancelBooking cancels a passenger's booking and returns its seats on every
+// leg. It fails once the cancellation window has passed or any leg has started.
+func (rm *rideManager) CancelBooking(bookingID, reason string) error {
+	rm.bookingMu.Lock()
+	defer rm.bookingMu.Unlock()
+
+	booking, err := rm.bookings.GetBookingByID(bookingID)
+	if err != nil {
+		return fmt.Errorf("could not cancel booking %s: %v", bookingID, err)
+	}
+	if booking.Status == BookingCancelled {
+		return fmt.Errorf("booking %s is already cancelled", bookingID)
+	}
+	if booking.Status != BookingConfirmed {
+		return fmt.Errorf("booking %s is %s", bookingID, booking.Status)
+	}
+	now := rm.now()
+	if departure := booking.Legs[0].DepartureTime; rm.cancelWindow > 0 && !departure.IsZero() && departure.Sub(now) < rm.cancelWindow {
+		return fmt.Errorf("booking %s can no longer be cancelled within %v of departure", bookingID, rm.cancelWindow)
+	}
+	for _, leg := range booking.Legs {
+		ride, err := rm.storage.GetRideByID(leg.ID)
+		if err != nil {
+			return fmt.Errorf("could not cancel booking %s: %v", bookingID, err)
+		}
+		if !ride.Status.AcceptsBookings() {
+			return fmt.Errorf("booking %s can no longer be cancelled: ride %s is %s", bookingID, leg.ID, ride.Status)
+		}
+	}
+	return rm.cancelBooking(booking, BookingCancelled, reason, rm.cancelPolicy.cancellationFee(booking, now))
+}
+
+// cancelBooking moves a booking to status, returns its seats on every leg and
+// refunds what it paid for legs not yet completed, less feeRate of it, which
+// goes to the drivers. The caller must hold rm.bookingMu.
+func (rm *rideManager) cancelBooking(booking Booking, status BookingStatus, reason string, feeRate float64) error {
+	now := rm.now()
+	owed := rm.unsettled(booking)
+	var amount Money
+	for _, legAmount := range owed {
+		amount += legAmount
+	}
+	fee := Money(math.Round(float64(amount) * feeRate))
+	booking.Status = status
+	booking.CancelledAt = now
+	booking.CancellationReason = reason
+	booking.CancellationFee = float64(fee) / 100
+	booking.UpdatedAt = now
+	if err := rm.bookings.UpdateBooking(booking); err != nil {
+		return fmt.Errorf("could not cancel booking %s: %v", booking.ID, err)
+	}
+	// Once saved as cancelled the booking can't be cancelled again, so its
+	// seats are returned whether or not the refund goes through.
+	var errs []error
+	if err := rm.forfeit(booking, owed, fee); err != nil {
+		errs = append(errs, fmt.Errorf("not refunded: %v", err))
+	}
+	if err := rm.returnSeats(booking.PassengerID, booking.Legs, booking.Seats); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("booking %s cancelled but %v", booking.ID, err)
+	}
+	fmt.Printf("Booking cancelled: %v (%s)\n", booking.ID, reason)
+	if fee > 0 {
+		fmt.Printf("Cancellation fee: %v of %v kept\n", fee, amount)
+	}
+	return nil
+}
+
+// dropUnstartedLegs refunds a booking whose journey is under way for the legs
+// it has not started and returns their seats, after a driver cancelled one of
+// them. The legs already started stay booked and are paid out as usual. The
+// caller must hold rm.bookingMu.
+func (rm *rideManager) dropUnstartedLegs(booking Booking, reason string) error {
+	var kept, dropped []Ride
+	var fares []float64
+	var refund Money
+	for i, leg := range booking.Legs {
+		if ride, err := rm.storage.GetRideByID(leg.ID); err == nil && ride.Status.IsUnderWay() {
+			kept = append(kept, leg)
+			if i < len(booking.LegFares) {
+				fares = append(fares, booking.LegFares[i])
+			}
+			continue
+		}
+		dropped = append(dropped, leg)
+		refund += booking.legAmount(i)
+	}
+	booking.Legs, booking.LegFares = kept, fares
+	booking.JourneyTime, booking.Transfers = journeyTiming(kept)
+	booking.Price = booking.price()
+	booking.DroppedLegs = append(booking.DroppedLegs, dropped...)
+	booking.UpdatedAt = rm.now()
+	if err := rm.bookings.UpdateBooking(booking); err != nil {
+		return fmt.Errorf("could not drop legs of booking %s: %v", booking.ID, err)
+	}
+	var errs []error
+	if err := rm.refundBooking(booking, refund, reason); err != nil {
+		errs = append(errs, fmt.Errorf("not refunded: %v", err))
+	}
+	if err := rm.returnSeats(booking.PassengerID, dropped, booking.Seats); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("booking %s dropped rides %v but %v", booking.ID, Booking{Legs: dropped}.RideIDs(), err)
+	}
+	fmt.Printf("Booking %v: rides %v dropped (%s)\n", booking.ID, Booking{Legs: dropped}.RideIDs(), reason)
+	return nil
+}
+
+// returnSeats releases a passenger's seats on legs and shares the cost of any
+// split-cost leg again among the passengers left on it.
+func (rm *rideManager) returnSeats(passengerID string, legs []Ride, seats int) error {
+	var errs []error
+	for _, leg := range legs {
+		if err := rm.releaseSeats(leg, seats); err != nil {
+			errs = append(errs, fmt.Errorf("ride %s: %v", leg.ID, err))
+			continue
+		}
+		rm.decrementTakenStats(passengerID)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("seats were not returned: %v", err)
+	}
+	return rm.updateCostShares(legs)
+}
@@ -0,0 +1,49 @@
+package main
+
+import "sort"
+
+// bookingIndex holds the secondary indexes booking storages keep alongside
+// their booking maps, mapping a ride or passenger to the set of booking IDs
+// having it. It is not safe for concurrent use; booking storages guard it with
+// their own lock.
+type bookingIndex struct {
+	byRide      map[string]map[string]bool
+	byPassenger map[string]map[string]bool
+}
+
+func newBookingIndex() *bookingIndex {
+	return &bookingIndex{
+		byRide:      make(map[string]map[string]bool),
+		byPassenger: make(map[string]map[string]bool),
+	}
+}
+
+func (idx *bookingIndex) add(booking Booking) {
+	for _, leg := range booking.Legs {
+		addTo(idx.byRide, leg.ID, booking.ID)
+	}
+	addTo(idx.byPassenger, booking.PassengerID, booking.ID)
+}
+
+func (idx *bookingIndex) remove(booking Booking) {
+	for _, leg := range booking.Legs {
+		removeFrom(idx.byRide, leg.ID, booking.ID)
+	}
+	removeFrom(idx.byPassenger, booking.PassengerID, booking.ID)
+}
+
+// replace re-indexes a booking whose stored version was old.
+func (idx *bookingIndex) replace(old, booking Booking) {
+	idx.remove(old)
+	idx.add(booking)
+}
+
+// bookingsFor returns the bookings with the given IDs, ordered by ID.
+func bookingsFor(bookings map[string]Booking, ids map[string]bool) []Booking {
+	result := make([]Booking, 0, len(ids))
+	for id := range ids {
+		result = append(result, bookings[id])
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
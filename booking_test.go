@@ -0,0 +1,148 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that selecting rides records bookings that can be listed by ride and passenger
+func TestSelectRideCreatesBooking(t *testing.T) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+	bookingStorage := NewInMemoryBookingStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, bookingStorage, userMgr, vehicleMgr)
+
+	_ = userMgr.AddUser(User{ID: "1", Name: "Amar", Role: Driver})
+	_ = userMgr.AddUser(User{ID: "2", Name: "Chetan", Role: Driver})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "2", OwnerID: "2", Model: "XUV", Capacity: 7})
+	_ = rideMgr.OfferRide(Ride{ID: "1", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4})
+	_ = rideMgr.OfferRide(Ride{ID: "2", DriverID: "2", VehicleID: "2", Source: "B", Destination: "C", AvailableSeats: 4})
+
+	indirect, err := rideMgr.SelectRide("3", "A", "C", 2, string(MostVacantSeats))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	direct, err := rideMgr.SelectRide("4", "A", "B", 1, string(MostVacantSeats))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if indirect.ID == direct.ID {
+		t.Fatalf("Expected distinct booking IDs, but both are %s", indirect.ID)
+	}
+	if ids := indirect.RideIDs(); len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+		t.Fatalf("Expected legs [1 2], but got %v", ids)
+	}
+	if indirect.Seats != 2 || indirect.Status != BookingConfirmed || indirect.CreatedAt.IsZero() {
+		t.Fatalf("Unexpected booking %+v", indirect)
+	}
+
+	stored, err := rideMgr.GetBookingByID(direct.ID)
+	if err != nil {
+		t.Fatalf("Expected to retrieve booking, but got error %v", err)
+	}
+	if stored.PassengerID != "4" {
+		t.Fatalf("Expected passenger 4, but got %s", stored.PassengerID)
+	}
+	if passengers := rideMgr.GetBookingsByRide("1"); len(passengers) != 2 {
+		t.Fatalf("Expected 2 bookings on ride 1, but got %d", len(passengers))
+	}
+	if passengers := rideMgr.GetBookingsByRide("2"); len(passengers) != 1 {
+		t.Fatalf("Expected 1 booking on ride 2, but got %d", len(passengers))
+	}
+	if bookings := rideMgr.GetBookingsByPassenger("3"); len(bookings) != 1 || bookings[0].ID != indirect.ID {
+		t.Fatalf("Expected passenger 3 to hold booking %s, but got %v", indirect.ID, bookings)
+	}
+}
+
+// Test that cancelling a booking returns seats on every leg and records the reason
+func TestCancelBooking(t *testing.T) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+	bookingStorage := NewInMemoryBookingStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, bookingStorage, userMgr, vehicleMgr)
+
+	_ = userMgr.AddUser(User{ID: "1", Name: "Amar", Role: Driver})
+	_ = userMgr.AddUser(User{ID: "2", Name: "Chetan", Role: Driver})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "2", OwnerID: "2", Model: "XUV", Capacity: 7})
+	_ = rideMgr.OfferRide(Ride{ID: "1", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4})
+	_ = rideMgr.OfferRide(Ride{ID: "2", DriverID: "2", VehicleID: "2", Source: "B", Destination: "C", AvailableSeats: 4})
+
+	booking, err := rideMgr.SelectRide("3", "A", "C", 3, string(MostVacantSeats))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if err := rideMgr.CancelBooking(booking.ID, "change of plans"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	for _, rideID := range []string{"1", "2"} {
+		ride, _ := rideStorage.GetRideByID(rideID)
+		if ride.AvailableSeats != 4 {
+			t.Fatalf("Expected 4 seats on ride %s, but got %d", rideID, ride.AvailableSeats)
+		}
+	}
+	if taken := rideMgr.rideStats["3"].taken; taken != 0 {
+		t.Fatalf("Expected no rides taken, but got %d", taken)
+	}
+	cancelled, _ := rideMgr.GetBookingByID(booking.ID)
+	if cancelled.Status != BookingCancelled || cancelled.CancellationReason != "change of plans" || cancelled.CancelledAt.IsZero() {
+		t.Fatalf("Unexpected cancelled booking %+v", cancelled)
+	}
+
+	if err := rideMgr.CancelBooking(booking.ID, "again"); err == nil {
+		t.Fatalf("Expected error cancelling twice")
+	}
+}
+
+// Test that cancellation is refused close to departure or once the ride has
+// ended
+func TestCancelBookingCutoffs(t *testing.T) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+	bookingStorage := NewInMemoryBookingStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, bookingStorage, userMgr, vehicleMgr)
+
+	clock := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	rideMgr.now = func() time.Time { return clock }
+	rideMgr.SetCancellationWindow(time.Hour)
+
+	_ = userMgr.AddUser(User{ID: "1", Name: "Amar", Role: Driver})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4})
+	departure := clock.Add(3 * time.Hour)
+	_ = rideMgr.OfferRide(Ride{ID: "1", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4, DepartureTime: departure, ArrivalTime: departure.Add(time.Hour)})
+
+	early, _ := rideMgr.SelectRide("2", "A", "B", 1, string(MostVacantSeats))
+	late, _ := rideMgr.SelectRide("3", "A", "B", 1, string(MostVacantSeats))
+	ended, _ := rideMgr.SelectRide("4", "A", "B", 1, string(MostVacantSeats))
+
+	clock = clock.Add(time.Hour)
+	if err := rideMgr.CancelBooking(early.ID, "in good time"); err != nil {
+		t.Fatalf("Expected no error cancelling two hours before departure, but got %v", err)
+	}
+	clock = clock.Add(90 * time.Minute)
+	if err := rideMgr.CancelBooking(late.ID, "too late"); err == nil {
+		t.Fatalf("Expected error cancelling within an hour of departure")
+	}
+
+	rideMgr.SetCancellationWindow(0)
+	_ = rideMgr.StartRide("1")
+	_ = rideMgr.EndRide("1")
+	if err := rideMgr.CancelBooking(ended.ID, "ride over"); err == nil {
+		t.Fatalf("Expected error cancelling after the ride ended")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// CancellationPolicy decides how much of a booking's price a passenger
+// forfeits by cancelling or not turning up. Fees are fractions of the price
+// and go to the drivers; the rest is refunded. A driver cancelling a ride
+// always refunds its passengers in full for the rides they have not started.
+type CancellationPolicy struct {
+	FreeWindow time.Duration // cancelling this soon after booking is free
+	FreeBefore time.Duration // so is cancelling at least this long before departure
+	LateFee    float64       // forfeited when cancelling outside both
+	NoShowFee  float64       // forfeited when the driver reports the passenger missing
+}
+
+func (p CancellationPolicy) validate() error {
+	if p.FreeWindow < 0 || p.FreeBefore < 0 {
+		return fmt.Errorf("free cancellation periods must not be negative")
+	}
+	for _, fee := range []float64{p.LateFee, p.NoShowFee} {
+		if fee < 0 || fee > 1 || math.IsNaN(fee) {
+			return fmt.Errorf("cancellation fees must be between 0 and 1, got %v", fee)
+		}
+	}
+	return nil
+}
+
+// cancellationFee returns the fraction of booking's price a passenger
+// cancelling at now forfeits.
+func (p CancellationPolicy) cancellationFee(booking Booking, now time.Time) float64 {
+	if p.FreeWindow > 0 && now.Sub(booking.CreatedAt) <= p.FreeWindow {
+		return 0
+	}
+	departure := booking.Legs[0].DepartureTime
+	if p.FreeBefore > 0 && !departure.IsZero() && departure.Sub(now) >= p.FreeBefore {
+		return 0
+	}
+	return p.LateFee
+}
+
+// SetCancellationPolicy sets the fees passengers pay for cancelling late and
+// for not turning up. Until one is set every cancellation is refunded in full.
+func (rm *rideManager) SetCancellationPolicy(policy CancellationPolicy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+	rm.bookingMu.Lock()
+	defer rm.bookingMu.Unlock()
+	rm.cancelPolicy = policy
+	return nil
+}
+
+// ReportNoShow records that a passenger did not turn up for a ride that is
+// boarding or under way. Their seats are returned on every leg and the no-show
+// fee is kept from the refund.
+func (rm *rideManager) ReportNoShow(bookingID string) error {
+	rm.bookingMu.Lock()
+	defer rm.bookingMu.Unlock()
+
+	booking, err := rm.bookings.GetBookingByID(bookingID)
+	if err != nil {
+		return fmt.Errorf("could not report no-show for booking %s: %v", bookingID, err)
+	}
+	if booking.Status != BookingConfirmed {
+		return fmt.Errorf("booking %s is %s", bookingID, booking.Status)
+	}
+	started := false
+	for _, leg := range booking.Legs {
+		ride, err := rm.storage.GetRideByID(leg.ID)
+		if err != nil {
+			return fmt.Errorf("could not report no-show for booking %s: %v", bookingID, err)
+		}
+		started = started || ride.Status == RideBoarding || ride.Status == RideInProgress
+	}
+	if !started {
+		return fmt.Errorf("booking %s has no ride boarding or under way", bookingID)
+	}
+	return rm.cancelBooking(booking, BookingNoShow, "passenger did not show up", rm.cancelPolicy.NoShowFee)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Test which cancellations the policy lets off free
+func TestCancellationFee(t *testing.T) {
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	policy := CancellationPolicy{FreeWindow: 10 * time.Minute, FreeBefore: 2 * time.Hour, LateFee: 0.5}
+	tests := []struct {
+		booked    time.Duration // before now
+		departure time.Duration // after now; zero for an unscheduled ride
+		expected  float64
+	}{
+		{booked: 5 * time.Minute, departure: time.Hour, expected: 0},
+		{booked: time.Hour, departure: 3 * time.Hour, expected: 0},
+		{booked: time.Hour, departure: time.Hour, expected: 0.5},
+		{booked: time.Hour, departure: 0, expected: 0.5},
+	}
+	for _, tt := range tests {
+		leg := Ride{ID: "1"}
+		if tt.departure != 0 {
+			leg.DepartureTime = now.Add(tt.departure)
+		}
+		booking := Booking{Legs: []Ride{leg}, CreatedAt: now.Add(-tt.booked)}
+		if got := policy.cancellationFee(booking, now); got != tt.expected {
+			t.Fatalf("Booked %v ago, departing in %v: expected a fee of %v, but got %v", tt.booked, tt.departure, tt.expected, got)
+		}
+	}
+
+	if err := (CancellationPolicy{LateFee: 1.5}).validate(); err == nil {
+		t.Fatalf("Expected an error for a fee above 1, but got nil")
+	}
+}
+
+// Test the ledger entries posted as passengers cancel, drivers cancel and
+// passengers don't show up
+func TestCancellationPostings(t *testing.T) {
+	rideMgr := newStrategyFixture(t)
+	now := rideMgr.now()
+	rideMgr.now = func() time.Time { return now }
+	rideMgr.SetFareFunc(func(Ride) float64 { return 100 })
+	ledger := NewLedgerManager(NewInMemoryLedgerStorage())
+	if err := rideMgr.SetLedger(ledger, 0.1); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	policy := CancellationPolicy{FreeWindow: 10 * time.Minute, FreeBefore: 3 * time.Hour, LateFee: 0.5, NoShowFee: 1}
+	if err := rideMgr.SetCancellationPolicy(policy); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	for _, passengerID := range []string{"p1", "p2", "p3", "p4"} {
+		if _, err := ledger.TopUp(passengerID, 100_00); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+	}
+	book := func(passengerID string) Booking {
+		booking, err := rideMgr.SelectRide(passengerID, "A", "B", 1, "")
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		return booking
+	}
+
+	// Cancelling within the free window is refunded in full.
+	free := book("p1")
+	if err := rideMgr.CancelBooking(free.ID, "plans changed"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if ledger.Balance("p1") != 100_00 {
+		t.Fatalf("Expected a full refund, but the balance is %v", ledger.Balance("p1"))
+	}
+
+	// Later, and within three hours of departure, half the fare goes to the
+	// driver.
+	late := book("p2")
+	now = now.Add(30 * time.Minute)
+	if err := rideMgr.CancelBooking(late.ID, "plans changed"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	driverID := late.Legs[0].DriverID
+	if ledger.Balance("p2") != 50_00 || ledger.Balance(driverID) != 45_00 {
+		t.Fatalf("Expected p2 to forfeit 50.00 and the driver to earn 45.00, but got %v and %v", ledger.Balance("p2"), ledger.Balance(driverID))
+	}
+	if cancelled, _ := rideMgr.GetBookingByID(late.ID); cancelled.CancellationFee != 50 {
+		t.Fatalf("Expected the fee to be recorded on the booking, but got %v", cancelled.CancellationFee)
+	}
+
+	// A driver cancelling refunds in full, whatever the policy.
+	dropped := book("p3")
+	if err := rideMgr.CancelRide(dropped.Legs[0].ID, "car broke down"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if ledger.Balance("p3") != 100_00 {
+		t.Fatalf("Expected a full refund, but the balance is %v", ledger.Balance("p3"))
+	}
+
+	// A no-show can only be reported once the ride is boarding, and forfeits
+	// the no-show fee.
+	missing := book("p4")
+	rideID := missing.Legs[0].ID
+	if err := rideMgr.ReportNoShow(missing.ID); err == nil {
+		t.Fatalf("Expected an error reporting a no-show before boarding, but got nil")
+	}
+	if err := rideMgr.BoardRide(rideID); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := rideMgr.ReportNoShow(missing.ID); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := rideMgr.ReportNoShow(missing.ID); err == nil {
+		t.Fatalf("Expected an error reporting a no-show twice, but got nil")
+	}
+	if err := rideMgr.CancelBooking(missing.ID, "plans changed"); err == nil {
+		t.Fatalf("Expected an error cancelling a no-show, but got nil")
+	}
+	if err := rideMgr.EndRide(rideID); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	driverID = missing.Legs[0].DriverID
+	if ledger.Balance("p4") != 0 || ledger.Balance(driverID) != 90_00 {
+		t.Fatalf("Expected p4 to forfeit 100.00 and the driver to earn 90.00 once, but got %v and %v", ledger.Balance("p4"), ledger.Balance(driverID))
+	}
+
+	if escrow := ledger.storage.GetBalance(EscrowAccount); escrow != 0 {
+		t.Fatalf("Expected nothing left in escrow, but got %v", escrow)
+	}
+	if err := ledger.CheckBalanced(); err != nil {
+		t.Fatalf("Expected the ledger to balance, but got %v", err)
+	}
+}
+
+// Test that a driver cancelling a later leg of a journey under way refunds
+// only the legs not yet started, and the started leg is still paid out
+func TestCancelRideMidJourney(t *testing.T) {
+	rideMgr, rideStorage := newRoutingFixture(t)
+	rideMgr.SetRouteObjective(ShortestDuration)
+	rideMgr.SetFareFunc(func(Ride) float64 { return 100 })
+	ledger := NewLedgerManager(NewInMemoryLedgerStorage())
+	_ = rideMgr.SetLedger(ledger, 0)
+	_, _ = ledger.TopUp("p1", 1000_00)
+
+	booking, err := rideMgr.SelectRide("p1", "A", "D", 1, "")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := rideMgr.StartRide("AB"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := rideMgr.CancelRide("BC", "car broke down"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	kept, _ := rideMgr.GetBookingByID(booking.ID)
+	if kept.Status != BookingConfirmed || fmt.Sprint(kept.RideIDs()) != "[AB]" || len(kept.DroppedLegs) != 2 {
+		t.Fatalf("Expected the booking to keep ride AB only, but got %+v", kept)
+	}
+	if ledger.Balance("p1") != 900_00 {
+		t.Fatalf("Expected rides BC and CD to be refunded, but the balance is %v", ledger.Balance("p1"))
+	}
+	for id, seats := range map[string]int{"AB": 3, "CD": 4} {
+		if ride, _ := rideStorage.GetRideByID(id); ride.AvailableSeats != seats {
+			t.Fatalf("Expected %d seats on ride %s, but got %d", seats, id, ride.AvailableSeats)
+		}
+	}
+
+	if err := rideMgr.EndRide("AB"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if ledger.Balance("AB") != 100_00 || ledger.Balance("BC") != 0 {
+		t.Fatalf("Expected only the driver of AB to be paid, but got %v and %v", ledger.Balance("AB"), ledger.Balance("BC"))
+	}
+	if escrow := ledger.storage.GetBalance(EscrowAccount); escrow != 0 {
+		t.Fatalf("Expected nothing left in escrow, but got %v", escrow)
+	}
+}
+
+// failingLedgerStorage fails to record refunds to one account
+type failingLedgerStorage struct {
+	LedgerStorage
+	failAccount AccountID
+}
+
+func (s *failingLedgerStorage) AddTransaction(tx Transaction) error {
+	for _, posting := range tx.Postings {
+		if tx.Kind == Refund && posting.Account == s.failAccount {
+			return fmt.Errorf("disk full")
+		}
+	}
+	return s.LedgerStorage.AddTransaction(tx)
+}
+
+// Test that a cancelled booking returns its seats even when the refund fails
+func TestCancelBookingRefundFails(t *testing.T) {
+	rideMgr := newStrategyFixture(t)
+	rideMgr.SetFareFunc(func(Ride) float64 { return 100 })
+	ledger := NewLedgerManager(&failingLedgerStorage{LedgerStorage: NewInMemoryLedgerStorage(), failAccount: WalletAccount("p1")})
+	_ = rideMgr.SetLedger(ledger, 0)
+	_, _ = ledger.TopUp("p1", 100_00)
+
+	booking, err := rideMgr.SelectRide("p1", "A", "B", 1, "")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := rideMgr.CancelBooking(booking.ID, "plans changed"); err == nil {
+		t.Fatalf("Expected an error when the refund fails, but got nil")
+	}
+	rideID := booking.Legs[0].ID
+	ride, _ := rideMgr.storage.GetRideByID(rideID)
+	if ride.AvailableSeats != booking.Legs[0].AvailableSeats+1 {
+		t.Fatalf("Expected the seat on ride %s to be returned, but %d are free", rideID, ride.AvailableSeats)
+	}
+}
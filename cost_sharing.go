@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// PricingMode is how passengers on a ride pay for their seats.
+type PricingMode string
+
+const (
+	ScheduledFare       PricingMode = ""           // the fare schedule, raised by any surge
+	PerSeatContribution PricingMode = "Per Seat"   // SeatContribution per seat, set by the driver
+	SplitCost           PricingMode = "Split Cost" // TripCost shared evenly by the driver and every booked seat
+)
+
+// validatePricing checks that a ride sets the amount its pricing mode needs
+// and no other.
+func (r Ride) validatePricing() error {
+	if r.SeatContribution < 0 || r.TripCost < 0 || math.IsNaN(r.SeatContribution) || math.IsNaN(r.TripCost) {
+		return fmt.Errorf("ride %s has a negative price", r.ID)
+	}
+	switch r.Pricing {
+	case ScheduledFare:
+		if r.SeatContribution != 0 || r.TripCost != 0 {
+			return fmt.Errorf("ride %s sets a price but is charged by the fare schedule", r.ID)
+		}
+	case PerSeatContribution:
+		if r.SeatContribution == 0 || r.TripCost != 0 {
+			return fmt.Errorf("ride %s must set only a seat contribution", r.ID)
+		}
+	case SplitCost:
+		if r.TripCost == 0 || r.SeatContribution != 0 {
+			return fmt.Errorf("ride %s must set only a trip cost", r.ID)
+		}
+	default:
+		return fmt.Errorf("unknown pricing mode %q", r.Pricing)
+	}
+	return nil
+}
+
+// driverPriced reports whether any of rides is priced by its driver rather
+// than the fare schedule.
+func driverPriced(rides []Ride) bool {
+	for _, ride := range rides {
+		if ride.Pricing != ScheduledFare {
+			return true
+		}
+	}
+	return false
+}
+
+// costShare returns each occupant's share of a split-cost ride with seats
+// booked: the driver pays for a seat too.
+func costShare(ride Ride, seats int) float64 {
+	return roundFare(ride.TripCost / float64(seats+1))
+}
+
+// bookedSeats returns the seats held by confirmed bookings on ride rideID.
+func (rm *rideManager) bookedSeats(rideID string) int {
+	seats := 0
+	for _, booking := range rm.GetBookingsByRide(rideID) {
+		if booking.Status == BookingConfirmed {
+			seats += booking.Seats
+		}
+	}
+	return seats
+}
+
+// legFare returns the per-seat fare of leg for a new booking of seats. Legs
+// of scheduled-fare rides are priced by fare, raised by surge, and are free
+// when fare is nil; drivers' own prices are never surged.
+func (rm *rideManager) legFare(leg Ride, seats int, fare func(Ride) float64, surge float64) float64 {
+	switch leg.Pricing {
+	case PerSeatContribution:
+		return leg.SeatContribution
+	case SplitCost:
+		return costShare(leg, rm.bookedSeats(leg.ID)+seats)
+	default:
+		if fare == nil {
+			return 0
+		}
+		return roundFare(fare(leg) * surge)
+	}
+}
+
+// updateCostShares reprices the split-cost legs of every confirmed booking on
+// the rides of legs, so everyone pays the same share as passengers book and
+// cancel, and charges or refunds the difference. It reprices every booking or,
+// restoring those already done, none of them. The caller must hold
+// rm.bookingMu.
+func (rm *rideManager) updateCostShares(legs []Ride) error {
+	var repriced [][2]Booking // each booking before and after, in order
+	for _, leg := range legs {
+		if leg.Pricing != SplitCost {
+			continue
+		}
+		share := costShare(leg, rm.bookedSeats(leg.ID))
+		for _, booking := range rm.GetBookingsByRide(leg.ID) {
+			if booking.Status != BookingConfirmed {
+				continue
+			}
+			updated := booking
+			updated.LegFares = append([]float64(nil), booking.LegFares...)
+			for i, booked := range booking.Legs {
+				if booked.ID == leg.ID && i < len(updated.LegFares) {
+					updated.LegFares[i] = share
+				}
+			}
+			if updated.Price = updated.price(); updated.Price == booking.Price {
+				continue
+			}
+			updated.UpdatedAt = rm.now()
+			if err := rm.repriceBooking(booking, updated); err != nil {
+				var errs []error
+				for i := len(repriced) - 1; i >= 0; i-- {
+					if rbErr := rm.repriceBooking(repriced[i][1], repriced[i][0]); rbErr != nil {
+						errs = append(errs, rbErr)
+					}
+				}
+				if rbErr := errors.Join(errs...); rbErr != nil {
+					return fmt.Errorf("%v; restoring cost shares failed: %v", err, rbErr)
+				}
+				return err
+			}
+			repriced = append(repriced, [2]Booking{booking, updated})
+		}
+	}
+	for _, pair := range repriced {
+		fmt.Printf("Cost share updated: %v now pays %.2f per seat\n", pair[1].ID, pair[1].Share())
+	}
+	return nil
+}
+
+// repriceBooking saves booking at its new price, as updated, and charges or
+// refunds the difference, saving it as it was again if that fails.
+func (rm *rideManager) repriceBooking(booking, updated Booking) error {
+	if err := rm.bookings.UpdateBooking(updated); err != nil {
+		return fmt.Errorf("could not update cost share of booking %s: %v", booking.ID, err)
+	}
+	if err := rm.adjustCharge(updated, booking.amount()); err != nil {
+		if rbErr := rm.bookings.UpdateBooking(booking); rbErr != nil {
+			return fmt.Errorf("could not adjust charge of booking %s: %v; restoring it failed: %v", booking.ID, err, rbErr)
+		}
+		return fmt.Errorf("could not adjust charge of booking %s: %v", booking.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that OfferRide accepts only the price a pricing mode needs
+func TestOfferRideValidatesPricing(t *testing.T) {
+	rideMgr := newStrategyFixture(t)
+	departure := rideMgr.now().Add(5 * time.Hour)
+	tests := []Ride{
+		{ID: "4", SeatContribution: 50},
+		{ID: "4", Pricing: PerSeatContribution},
+		{ID: "4", Pricing: PerSeatContribution, SeatContribution: 50, TripCost: 200},
+		{ID: "4", Pricing: SplitCost},
+		{ID: "4", Pricing: SplitCost, TripCost: -200},
+		{ID: "4", Pricing: "Haggle", TripCost: 200},
+	}
+	for _, ride := range tests {
+		ride.DriverID, ride.VehicleID, ride.Source, ride.Destination = "1", "1", "C", "D"
+		ride.AvailableSeats, ride.DepartureTime, ride.ArrivalTime = 3, departure, departure.Add(time.Hour)
+		if err := rideMgr.OfferRide(ride); err == nil {
+			t.Fatalf("Expected an error offering %+v, but got nil", ride)
+		}
+	}
+}
+
+// Test that a driver's seat contribution is charged as set, without surge
+func TestPerSeatContribution(t *testing.T) {
+	rideMgr := newStrategyFixture(t)
+	rideMgr.SetFareFunc(func(Ride) float64 { return 100 })
+	if err := rideMgr.SetSurgePolicy(SurgePolicy{Window: time.Hour, Max: 3}); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	departure := rideMgr.now().Add(5 * time.Hour)
+	ride := Ride{ID: "4", DriverID: "1", VehicleID: "1", Source: "C", Destination: "D", AvailableSeats: 3, Pricing: PerSeatContribution, SeatContribution: 80, DepartureTime: departure, ArrivalTime: departure.Add(time.Hour)}
+	if err := rideMgr.OfferRide(ride); err != nil {
+		t.Fatalf("Error offering ride: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		_, _ = rideMgr.Quote("C", "D", 1, "", TimeWindow{})
+	}
+
+	booking, err := rideMgr.SelectRide("passenger", "C", "D", 2, "")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if booking.Share() != 80 || booking.Price != 160 {
+		t.Fatalf("Expected 80 per passenger and 160 in total, but got %v and %v", booking.Share(), booking.Price)
+	}
+
+	// The cheapest option compares driver prices with scheduled fares.
+	it, err := rideMgr.Quote("A", "B", 1, "sort=fare", TimeWindow{})
+	if err != nil || it.Legs[0].Fare != 100 {
+		t.Fatalf("Expected a scheduled fare of 100, but got %+v (%v)", it, err)
+	}
+}
+
+// Test that a split-cost ride is shared evenly by the driver and every booked
+// seat, and shares follow bookings and cancellations
+func TestSplitCost(t *testing.T) {
+	rideMgr := newStrategyFixture(t)
+	departure := rideMgr.now().Add(5 * time.Hour)
+	ride := Ride{ID: "4", DriverID: "1", VehicleID: "1", Source: "C", Destination: "D", AvailableSeats: 4, Pricing: SplitCost, TripCost: 300, DepartureTime: departure, ArrivalTime: departure.Add(time.Hour)}
+	if err := rideMgr.OfferRide(ride); err != nil {
+		t.Fatalf("Error offering ride: %v", err)
+	}
+
+	it, err := rideMgr.Quote("C", "D", 1, "", TimeWindow{})
+	if err != nil || it.Price != 150 {
+		t.Fatalf("Expected a quote of 150 for the first seat, but got %+v (%v)", it, err)
+	}
+	first, err := rideMgr.SelectRide("p1", "C", "D", 1, "")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if first.Share() != 150 || first.Price != 150 {
+		t.Fatalf("Expected the first passenger to share 150, but got %v", first.Price)
+	}
+
+	second, err := rideMgr.SelectRide("p2", "C", "D", 2, "")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if second.Share() != 75 || second.Price != 150 {
+		t.Fatalf("Expected 75 per passenger and 150 in total, but got %v and %v", second.Share(), second.Price)
+	}
+	share := func(bookingID string) float64 {
+		booking, err := rideMgr.GetBookingByID(bookingID)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		return booking.Price
+	}
+	if got := share(first.ID); got != 75 {
+		t.Fatalf("Expected the first passenger's share to drop to 75, but got %v", got)
+	}
+
+	if err := rideMgr.CancelBooking(second.ID, "plans changed"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if got := share(first.ID); got != 150 {
+		t.Fatalf("Expected the first passenger's share to return to 150, but got %v", got)
+	}
+	if got := share(second.ID); got != 150 {
+		t.Fatalf("Expected the cancelled booking to keep its last price, but got %v", got)
+	}
+}
@@ -0,0 +1,773 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// defaultCompactEvery is the number of journal records written before the
+// journal is folded into a fresh snapshot.
+const defaultCompactEvery = 1000
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// journalRecord is a single line of the append-only journal.
+type journalRecord struct {
+	Op    string          `json:"op"`
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// journal is an append-only log of mutations backed by a snapshot file.
+// On disk a store named "rides" lives in <dir>/rides.snapshot and <dir>/rides.log.
+type journal struct {
+	dir          string
+	name         string
+	file         *os.File
+	size         int64 // offset just past the last durable record
+	records      int
+	compactEvery int
+}
+
+func (j *journal) snapshotPath() string { return filepath.Join(j.dir, j.name+".snapshot") }
+func (j *journal) logPath() string      { return filepath.Join(j.dir, j.name+".log") }
+
+// openJournal loads the snapshot, replays the log on top of it and returns the
+// recovered state. A torn record at the tail of the log (a crash mid-write) is
+// discarded and truncated away; corruption anywhere else is an error.
+func openJournal[T any](dir, name string) (map[string]T, *journal, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, nil, fmt.Errorf("could not create storage dir: %v", err)
+	}
+	j := &journal{dir: dir, name: name, compactEvery: defaultCompactEvery}
+
+	state := make(map[string]T)
+	data, err := os.ReadFile(j.snapshotPath())
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, nil, fmt.Errorf("corrupt snapshot %s: %v", j.snapshotPath(), err)
+		}
+	case !os.IsNotExist(err):
+		return nil, nil, fmt.Errorf("could not read snapshot: %v", err)
+	}
+
+	f, err := os.OpenFile(j.logPath(), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open journal: %v", err)
+	}
+	valid, records, err := replay(f, state)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if err := f.Truncate(valid); err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("could not truncate journal: %v", err)
+	}
+	if _, err := f.Seek(valid, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("could not seek journal: %v", err)
+	}
+	j.file = f
+	j.size = valid
+	j.records = records
+	return state, j, nil
+}
+
+// replay applies every complete record in r to state and returns the byte
+// offset just past the last good record. Only the final record may be torn;
+// a bad record followed by others means the log is corrupt.
+func replay[T any](r io.Reader, state map[string]T) (int64, int, error) {
+	var valid int64
+	records := 0
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			// Anything without a trailing newline is a torn write.
+			return valid, records, nil
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("could not read journal: %v", err)
+		}
+		if err := apply(line, state); err != nil {
+			if _, peekErr := br.Peek(1); peekErr == io.EOF {
+				return valid, records, nil
+			}
+			return 0, 0, fmt.Errorf("corrupt journal record at offset %d: %v", valid, err)
+		}
+		valid += int64(len(line))
+		records++
+	}
+}
+
+// apply decodes one journal line and applies it to state.
+func apply[T any](line []byte, state map[string]T) error {
+	var rec journalRecord
+	if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+		return err
+	}
+	switch rec.Op {
+	case opPut:
+		var v T
+		if err := json.Unmarshal(rec.Value, &v); err != nil {
+			return err
+		}
+		state[rec.Key] = v
+	case opDelete:
+		delete(state, rec.Key)
+	default:
+		return fmt.Errorf("unknown op %q", rec.Op)
+	}
+	return nil
+}
+
+// append durably writes a record to the journal.
+func (j *journal) append(op, key string, value any) error {
+	rec := journalRecord{Op: op, Key: key}
+	if value != nil {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("could not encode record: %v", err)
+		}
+		rec.Value = raw
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("could not encode record: %v", err)
+	}
+	line = append(line, '\n')
+	if _, err := j.file.Write(line); err != nil {
+		j.rewind()
+		return fmt.Errorf("could not write journal: %v", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		j.rewind()
+		return fmt.Errorf("could not sync journal: %v", err)
+	}
+	j.size += int64(len(line))
+	j.records++
+	return nil
+}
+
+// rewind drops a partially written record so the next append does not land
+// behind a torn line that replay would stop at.
+func (j *journal) rewind() {
+	_ = j.file.Truncate(j.size)
+	_, _ = j.file.Seek(j.size, io.SeekStart)
+}
+
+// maybeCompact writes a snapshot once enough records have accumulated. The
+// triggering write is already durable in the log, so a failed compaction is
+// not reported to the caller; it is simply retried on the next write.
+func (j *journal) maybeCompact(state any) {
+	if j.compactEvery <= 0 || j.records < j.compactEvery {
+		return
+	}
+	_ = j.compact(state)
+}
+
+// compact atomically replaces the snapshot with state and empties the log.
+// If we crash after the rename but before the truncate, replaying the old log
+// over the new snapshot is harmless because every record is idempotent.
+func (j *journal) compact(state any) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("could not encode snapshot: %v", err)
+	}
+	tmp, err := os.CreateTemp(j.dir, j.name+".snapshot-*")
+	if err != nil {
+		return fmt.Errorf("could not create snapshot: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write snapshot: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not sync snapshot: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not close snapshot: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), j.snapshotPath()); err != nil {
+		return fmt.Errorf("could not install snapshot: %v", err)
+	}
+	if err := syncDir(j.dir); err != nil {
+		return err
+	}
+	if err := j.file.Truncate(0); err != nil {
+		return fmt.Errorf("could not truncate journal: %v", err)
+	}
+	if _, err := j.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("could not seek journal: %v", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("could not sync journal: %v", err)
+	}
+	j.size = 0
+	j.records = 0
+	return nil
+}
+
+func (j *journal) close() error {
+	return j.file.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("could not open storage dir: %v", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("could not sync storage dir: %v", err)
+	}
+	return nil
+}
+
+//////
+
+// FileUserStorage implements UserStorage on top of a journal on disk
+type FileUserStorage struct {
+	mu      sync.Mutex
+	users   map[string]User
+	journal *journal
+}
+
+func NewFileUserStorage(dir string) (*FileUserStorage, error) {
+	users, j, err := openJournal[User](dir, "users")
+	if err != nil {
+		return nil, err
+	}
+	return &FileUserStorage{users: users, journal: j}, nil
+}
+
+func (s *FileUserStorage) AddUser(user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.users[user.ID]; exists {
+		return fmt.Errorf("user already exists")
+	}
+	if err := s.journal.append(opPut, user.ID, user); err != nil {
+		return err
+	}
+	s.users[user.ID] = user
+	s.journal.maybeCompact(s.users)
+	return nil
+}
+
+func (s *FileUserStorage) GetUserByID(userID string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, exists := s.users[userID]
+	if !exists {
+		return User{}, fmt.Errorf("user not found")
+	}
+	return user, nil
+}
+
+func (s *FileUserStorage) GetAllUsers() map[string]User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := make(map[string]User, len(s.users))
+	for id, user := range s.users {
+		users[id] = user
+	}
+	return users
+}
+
+func (s *FileUserStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.journal.close()
+}
+
+//////
+
+// FileVehicleStorage implements VehicleStorage on top of a journal on disk
+type FileVehicleStorage struct {
+	mu       sync.Mutex
+	vehicles map[string]Vehicle
+	journal  *journal
+}
+
+func NewFileVehicleStorage(dir string) (*FileVehicleStorage, error) {
+	vehicles, j, err := openJournal[Vehicle](dir, "vehicles")
+	if err != nil {
+		return nil, err
+	}
+	return &FileVehicleStorage{vehicles: vehicles, journal: j}, nil
+}
+
+func (s *FileVehicleStorage) AddVehicle(vehicle Vehicle) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.vehicles[vehicle.ID]; exists {
+		return fmt.Errorf("vehicle already exists")
+	}
+	if err := s.journal.append(opPut, vehicle.ID, vehicle); err != nil {
+		return err
+	}
+	s.vehicles[vehicle.ID] = vehicle
+	s.journal.maybeCompact(s.vehicles)
+	return nil
+}
+
+func (s *FileVehicleStorage) GetVehicleByID(vehicleID string) (Vehicle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vehicle, exists := s.vehicles[vehicleID]
+	if !exists {
+		return Vehicle{}, fmt.Errorf("vehicle not found")
+	}
+	return vehicle, nil
+}
+
+func (s *FileVehicleStorage) GetAllVehicles() map[string]Vehicle {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vehicles := make(map[string]Vehicle, len(s.vehicles))
+	for id, vehicle := range s.vehicles {
+		vehicles[id] = vehicle
+	}
+	return vehicles
+}
+
+func (s *FileVehicleStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.journal.close()
+}
+
+//////
+
+// FilePlaceStorage implements PlaceStorage on top of a journal on disk
+type FilePlaceStorage struct {
+	mu      sync.Mutex
+	places  map[string]Location
+	journal *journal
+}
+
+func NewFilePlaceStorage(dir string) (*FilePlaceStorage, error) {
+	places, j, err := openJournal[Location](dir, "places")
+	if err != nil {
+		return nil, err
+	}
+	return &FilePlaceStorage{places: places, journal: j}, nil
+}
+
+func (s *FilePlaceStorage) AddPlace(place Location) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.places[place.Name]; exists {
+		return fmt.Errorf("place already exists")
+	}
+	if err := s.journal.append(opPut, place.Name, place); err != nil {
+		return err
+	}
+	s.places[place.Name] = place
+	s.journal.maybeCompact(s.places)
+	return nil
+}
+
+func (s *FilePlaceStorage) GetPlaceByName(name string) (Location, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	place, exists := s.places[name]
+	if !exists {
+		return Location{}, fmt.Errorf("place not found")
+	}
+	return place, nil
+}
+
+func (s *FilePlaceStorage) GetAllPlaces() map[string]Location {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	places := make(map[string]Location, len(s.places))
+	for name, place := range s.places {
+		places[name] = place
+	}
+	return places
+}
+
+func (s *FilePlaceStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.journal.close()
+}
+
+//////
+
+// FileRideStorage implements RideStorage on top of a journal on disk
+type FileRideStorage struct {
+	mu      sync.Mutex
+	rides   map[string]Ride
+	index   *rideIndex
+	journal *journal
+}
+
+func NewFileRideStorage(dir string) (*FileRideStorage, error) {
+	rides, j, err := openJournal[Ride](dir, "rides")
+	if err != nil {
+		return nil, err
+	}
+	index := newRideIndex()
+	for id, ride := range rides {
+		// Rides written before statuses were tracked were all on offer.
+		if ride.Status == "" {
+			ride.Status = RideOffered
+			rides[id] = ride
+		}
+		index.add(ride)
+	}
+	return &FileRideStorage{rides: rides, index: index, journal: j}, nil
+}
+
+func (s *FileRideStorage) AddRide(ride Ride) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.rides[ride.ID]; exists {
+		return fmt.Errorf("ride already exists")
+	}
+	return s.put(ride)
+}
+
+func (s *FileRideStorage) GetRideByID(rideID string) (Ride, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ride, exists := s.rides[rideID]
+	if !exists {
+		return Ride{}, fmt.Errorf("ride not found")
+	}
+	return ride, nil
+}
+
+func (s *FileRideStorage) UpdateRide(ride Ride) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, exists := s.rides[ride.ID]
+	if !exists {
+		return fmt.Errorf("ride not found")
+	}
+	ride.Version = current.Version + 1
+	return s.put(ride)
+}
+
+func (s *FileRideStorage) CompareAndUpdateRide(ride Ride) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, exists := s.rides[ride.ID]
+	if !exists {
+		return fmt.Errorf("ride not found")
+	}
+	if current.Version != ride.Version {
+		return ErrVersionConflict
+	}
+	ride.Version++
+	return s.put(ride)
+}
+
+func (s *FileRideStorage) DeleteRide(rideID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ride, exists := s.rides[rideID]
+	if !exists {
+		return fmt.Errorf("ride not found")
+	}
+	if err := s.journal.append(opDelete, rideID, nil); err != nil {
+		return err
+	}
+	delete(s.rides, rideID)
+	s.index.remove(ride)
+	s.journal.maybeCompact(s.rides)
+	return nil
+}
+
+func (s *FileRideStorage) GetAllRides() map[string]Ride {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rides := make(map[string]Ride, len(s.rides))
+	for id, ride := range s.rides {
+		rides[id] = ride
+	}
+	return rides
+}
+
+func (s *FileRideStorage) GetRidesByDriver(driverID string) []Ride {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ridesFor(s.rides, s.index.byDriver[driverID])
+}
+
+func (s *FileRideStorage) GetRidesByVehicle(vehicleID string) []Ride {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ridesFor(s.rides, s.index.byVehicle[vehicleID])
+}
+
+func (s *FileRideStorage) GetRidesBySource(source string) []Ride {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ridesFor(s.rides, s.index.bySource[source])
+}
+
+func (s *FileRideStorage) GetRidesByRoute(source, destination string) []Ride {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ridesFor(s.rides, s.index.byRoute[routeKey{source, destination}])
+}
+
+func (s *FileRideStorage) GetRidesByStatus(status RideStatus) []Ride {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ridesFor(s.rides, s.index.byStatus[status])
+}
+
+func (s *FileRideStorage) GetRidesNear(center Location, radius float64) []Ride {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := s.index.grid.near(center, radius)
+	rides := make([]Ride, len(ids))
+	for i, id := range ids {
+		rides[i] = s.rides[id]
+	}
+	return rides
+}
+
+func (s *FileRideStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.journal.close()
+}
+
+// put journals and applies ride; the caller must hold s.mu.
+func (s *FileRideStorage) put(ride Ride) error {
+	if err := s.journal.append(opPut, ride.ID, ride); err != nil {
+		return err
+	}
+	if current, exists := s.rides[ride.ID]; exists {
+		s.index.replace(current, ride)
+	} else {
+		s.index.add(ride)
+	}
+	s.rides[ride.ID] = ride
+	s.journal.maybeCompact(s.rides)
+	return nil
+}
+
+//////
+
+// FileBookingStorage implements BookingStorage on top of a journal on disk
+type FileBookingStorage struct {
+	mu       sync.Mutex
+	bookings map[string]Booking
+	index    *bookingIndex
+	journal  *journal
+}
+
+func NewFileBookingStorage(dir string) (*FileBookingStorage, error) {
+	bookings, j, err := openJournal[Booking](dir, "bookings")
+	if err != nil {
+		return nil, err
+	}
+	index := newBookingIndex()
+	for _, booking := range bookings {
+		index.add(booking)
+	}
+	return &FileBookingStorage{bookings: bookings, index: index, journal: j}, nil
+}
+
+func (s *FileBookingStorage) AddBooking(booking Booking) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.bookings[booking.ID]; exists {
+		return fmt.Errorf("booking already exists")
+	}
+	return s.put(booking)
+}
+
+func (s *FileBookingStorage) GetBookingByID(bookingID string) (Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	booking, exists := s.bookings[bookingID]
+	if !exists {
+		return Booking{}, fmt.Errorf("booking not found")
+	}
+	return booking, nil
+}
+
+func (s *FileBookingStorage) UpdateBooking(booking Booking) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.bookings[booking.ID]; !exists {
+		return fmt.Errorf("booking not found")
+	}
+	return s.put(booking)
+}
+
+func (s *FileBookingStorage) GetAllBookings() map[string]Booking {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bookings := make(map[string]Booking, len(s.bookings))
+	for id, booking := range s.bookings {
+		bookings[id] = booking
+	}
+	return bookings
+}
+
+func (s *FileBookingStorage) GetBookingsByRide(rideID string) []Booking {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return bookingsFor(s.bookings, s.index.byRide[rideID])
+}
+
+func (s *FileBookingStorage) GetBookingsByPassenger(passengerID string) []Booking {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return bookingsFor(s.bookings, s.index.byPassenger[passengerID])
+}
+
+func (s *FileBookingStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.journal.close()
+}
+
+// put journals and applies booking; the caller must hold s.mu.
+func (s *FileBookingStorage) put(booking Booking) error {
+	if err := s.journal.append(opPut, booking.ID, booking); err != nil {
+		return err
+	}
+	if current, exists := s.bookings[booking.ID]; exists {
+		s.index.replace(current, booking)
+	} else {
+		s.index.add(booking)
+	}
+	s.bookings[booking.ID] = booking
+	s.journal.maybeCompact(s.bookings)
+	return nil
+}
+
+//////
+
+// FileLedgerStorage implements LedgerStorage on top of a journal on disk. The
+// per-account history and balances are rebuilt from the transactions on open.
+type FileLedgerStorage struct {
+	mu           sync.Mutex
+	transactions map[string]Transaction
+	byAccount    map[AccountID][]string // transaction IDs in the order added
+	balances     map[AccountID]Money
+	journal      *journal
+}
+
+func NewFileLedgerStorage(dir string) (*FileLedgerStorage, error) {
+	transactions, j, err := openJournal[Transaction](dir, "ledger")
+	if err != nil {
+		return nil, err
+	}
+	s := &FileLedgerStorage{
+		transactions: transactions,
+		byAccount:    make(map[AccountID][]string),
+		balances:     make(map[AccountID]Money),
+		journal:      j,
+	}
+	ordered := make([]Transaction, 0, len(transactions))
+	for _, tx := range transactions {
+		ordered = append(ordered, tx)
+	}
+	sort.Slice(ordered, func(i, k int) bool { return ordered[i].Seq < ordered[k].Seq })
+	for _, tx := range ordered {
+		s.index(tx)
+	}
+	return s, nil
+}
+
+func (s *FileLedgerStorage) AddTransaction(tx Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.transactions[tx.ID]; exists {
+		return fmt.Errorf("transaction already exists")
+	}
+	tx.Postings = append([]Posting(nil), tx.Postings...)
+	if err := s.journal.append(opPut, tx.ID, tx); err != nil {
+		return err
+	}
+	s.transactions[tx.ID] = tx
+	s.index(tx)
+	s.journal.maybeCompact(s.transactions)
+	return nil
+}
+
+func (s *FileLedgerStorage) GetTransactionByID(txID string) (Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, exists := s.transactions[txID]
+	if !exists {
+		return Transaction{}, fmt.Errorf("transaction not found")
+	}
+	return tx, nil
+}
+
+func (s *FileLedgerStorage) GetTransactionsByAccount(account AccountID) []Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := s.byAccount[account]
+	transactions := make([]Transaction, len(ids))
+	for i, id := range ids {
+		transactions[i] = s.transactions[id]
+	}
+	return transactions
+}
+
+func (s *FileLedgerStorage) TransactionCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.transactions)
+}
+
+func (s *FileLedgerStorage) GetBalance(account AccountID) Money {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.balances[account]
+}
+
+// GetAllBalances returns a snapshot; changes to it do not affect the storage.
+func (s *FileLedgerStorage) GetAllBalances() map[AccountID]Money {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	balances := make(map[AccountID]Money, len(s.balances))
+	for account, balance := range s.balances {
+		balances[account] = balance
+	}
+	return balances
+}
+
+func (s *FileLedgerStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.journal.close()
+}
+
+// index applies tx to the per-account history and balances; the caller must
+// hold s.mu or have sole access.
+func (s *FileLedgerStorage) index(tx Transaction) {
+	for _, p := range tx.Postings {
+		if ids := s.byAccount[p.Account]; len(ids) == 0 || ids[len(ids)-1] != tx.ID {
+			s.byAccount[p.Account] = append(ids, tx.ID)
+		}
+		s.balances[p.Account] += p.Amount
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Test that rides survive reopening the storage
+func TestFileRideStorageReopen(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewFileRideStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	ride := Ride{ID: "1", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 3, Status: RideOffered}
+	if err := storage.AddRide(ride); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	ride.AvailableSeats = 1
+	if err := storage.UpdateRide(ride); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	ride.Version = 1
+	if err := storage.AddRide(Ride{ID: "2", Source: "B", Destination: "C"}); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := storage.DeleteRide("2"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	storage.Close()
+
+	reopened, err := NewFileRideStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	defer reopened.Close()
+	retrievedRide, err := reopened.GetRideByID(ride.ID)
+	if err != nil {
+		t.Fatalf("Expected to retrieve ride, but got error %v", err)
+	}
+	if !reflect.DeepEqual(retrievedRide, ride) {
+		t.Fatalf("Expected ride to be %v, but got %v", ride, retrievedRide)
+	}
+	if _, err := reopened.GetRideByID("2"); err == nil {
+		t.Fatalf("Expected deleted ride to stay deleted")
+	}
+}
+
+// Test that rides logged before they had a status load as offered and can be
+// booked
+func TestFileRideStorageLegacyStatus(t *testing.T) {
+	dir := t.TempDir()
+	log := `{"op":"put","key":"1","value":{"ID":"1","DriverID":"1","VehicleID":"1","Source":"A","Destination":"B","AvailableSeats":3}}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "rides.log"), []byte(log), 0o644); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	storage, err := NewFileRideStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	defer storage.Close()
+	if ride, _ := storage.GetRideByID("1"); ride.Status != RideOffered {
+		t.Fatalf("Expected ride to be %v, but got %q", RideOffered, ride.Status)
+	}
+	if offered := storage.GetRidesByStatus(RideOffered); len(offered) != 1 {
+		t.Fatalf("Expected 1 offered ride, but got %d", len(offered))
+	}
+
+	userMgr := NewUserManager(NewInMemoryUserStorage())
+	vehicleMgr := NewVehicleManager(NewInMemoryVehicleStorage(), userMgr)
+	rideMgr := NewRideManager(storage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+	_ = userMgr.AddUser(User{ID: "1", Name: "Amar", Role: Driver})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4})
+	if _, err := rideMgr.SelectRide("3", "A", "B", 1, string(MostVacantSeats)); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+}
+
+// Test that a torn record at the end of the log is discarded
+func TestFileUserStorageTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewFileUserStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	user := User{ID: "1", Name: "Amar", Role: Driver}
+	if err := storage.AddUser(user); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	storage.Close()
+
+	f, err := os.OpenFile(filepath.Join(dir, "users.log"), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	f.WriteString(`{"op":"put","key":"2","value":{"ID":"2","Na`)
+	f.Close()
+
+	reopened, err := NewFileUserStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(reopened.GetAllUsers()) != 1 {
+		t.Fatalf("Expected 1 user, but got %d", len(reopened.GetAllUsers()))
+	}
+	// The next write must land on a clean line.
+	if err := reopened.AddUser(User{ID: "3", Name: "Vijay", Role: Passenger}); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	reopened.Close()
+
+	reopened, err = NewFileUserStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	defer reopened.Close()
+	if len(reopened.GetAllUsers()) != 2 {
+		t.Fatalf("Expected 2 users, but got %d", len(reopened.GetAllUsers()))
+	}
+}
+
+// Test that a bad record followed by good ones is reported, not truncated away
+func TestFileUserStorageCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewFileUserStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := storage.AddUser(User{ID: "1", Name: "Amar", Role: Driver}); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	storage.Close()
+
+	f, err := os.OpenFile(filepath.Join(dir, "users.log"), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	f.WriteString("{\"op\":\"put\",\"key\":\"2\",\"val\n")
+	f.WriteString(`{"op":"put","key":"3","value":{"ID":"3","Name":"Vijay","Role":"Passenger"}}` + "\n")
+	f.Close()
+
+	if _, err := NewFileUserStorage(dir); err == nil {
+		t.Fatalf("Expected an error for a corrupt record mid-log, but got nil")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "users.log"))
+	if err != nil || !strings.Contains(string(data), "Vijay") {
+		t.Fatalf("Expected the log to be left intact, but got %q (%v)", data, err)
+	}
+}
+
+// Test that compaction folds the log into the snapshot
+func TestFileVehicleStorageCompaction(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewFileVehicleStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	storage.journal.compactEvery = 2
+	for _, id := range []string{"1", "2", "3"} {
+		if err := storage.AddVehicle(Vehicle{ID: id, OwnerID: id, Model: "XUV", Capacity: 7}); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+	}
+	storage.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, "vehicles.snapshot")); err != nil {
+		t.Fatalf("Expected snapshot to exist, but got %v", err)
+	}
+	reopened, err := NewFileVehicleStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	defer reopened.Close()
+	if len(reopened.GetAllVehicles()) != 3 {
+		t.Fatalf("Expected 3 vehicles, but got %d", len(reopened.GetAllVehicles()))
+	}
+}
+
+// Test that places survive reopening the storage
+func TestFilePlaceStorageReopen(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewFilePlaceStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	place := Location{Name: "Home", Lat: 12.9716, Lon: 77.5946}
+	if err := storage.AddPlace(place); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := storage.AddPlace(place); err == nil {
+		t.Fatalf("Expected error adding a duplicate place, but got none")
+	}
+	storage.Close()
+
+	reopened, err := NewFilePlaceStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	defer reopened.Close()
+	retrieved, err := reopened.GetPlaceByName("Home")
+	if err != nil {
+		t.Fatalf("Expected to retrieve place, but got error %v", err)
+	}
+	if retrieved != place {
+		t.Fatalf("Expected %+v, but got %+v", place, retrieved)
+	}
+}
+
+// Test that wallet balances and statements survive reopening the ledger
+func TestFileLedgerStorageReopen(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewFileLedgerStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	ledger := NewLedgerManager(storage)
+	if _, err := ledger.TopUp("1", 500_00); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if _, err := ledger.Withdraw("1", 200_00); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	storage.Close()
+
+	reopened, err := NewFileLedgerStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	defer reopened.Close()
+	ledger = NewLedgerManager(reopened)
+	if balance := ledger.Balance("1"); balance != 300_00 {
+		t.Fatalf("Expected a balance of 300.00, but got %v", balance)
+	}
+	if statement := ledger.Statement("1"); len(statement) != 2 || statement[1].Kind != Withdrawal {
+		t.Fatalf("Expected the top-up and then the withdrawal, but got %+v", statement)
+	}
+	tx, err := ledger.TopUp("1", 100_00)
+	if err != nil || tx.ID != "T3" {
+		t.Fatalf("Expected numbering to continue at T3, but got %v (%v)", tx.ID, err)
+	}
+	if err := ledger.CheckBalanced(); err != nil {
+		t.Fatalf("Expected the ledger to balance, but got %v", err)
+	}
+}
@@ -1,9 +1,13 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"sync"
+)
 
 // InMemoryUserStorage implements UserStorage using a map
 type InMemoryUserStorage struct {
+	mu    sync.RWMutex
 	users map[string]User
 }
 
@@ -12,6 +16,8 @@ func NewInMemoryUserStorage() UserStorage {
 }
 
 func (s *InMemoryUserStorage) AddUser(user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if _, exists := s.users[user.ID]; exists {
 		return fmt.Errorf("user already exists")
 	}
@@ -20,6 +26,8 @@ func (s *InMemoryUserStorage) AddUser(user User) error {
 }
 
 func (s *InMemoryUserStorage) GetUserByID(userID string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	user, exists := s.users[userID]
 	if !exists {
 		return User{}, fmt.Errorf("user not found")
@@ -27,14 +35,22 @@ func (s *InMemoryUserStorage) GetUserByID(userID string) (User, error) {
 	return user, nil
 }
 
+// GetAllUsers returns a snapshot; changes to it do not affect the storage.
 func (s *InMemoryUserStorage) GetAllUsers() map[string]User {
-	return s.users
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make(map[string]User, len(s.users))
+	for id, user := range s.users {
+		users[id] = user
+	}
+	return users
 }
 
 //////
 
 // InMemoryVehicleStorage implements VehicleStorage using a map
 type InMemoryVehicleStorage struct {
+	mu       sync.RWMutex
 	vehicles map[string]Vehicle
 }
 
@@ -43,6 +59,8 @@ func NewInMemoryVehicleStorage() VehicleStorage {
 }
 
 func (s *InMemoryVehicleStorage) AddVehicle(vehicle Vehicle) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if _, exists := s.vehicles[vehicle.ID]; exists {
 		return fmt.Errorf("vehicle already exists")
 	}
@@ -51,6 +69,8 @@ func (s *InMemoryVehicleStorage) AddVehicle(vehicle Vehicle) error {
 }
 
 func (s *InMemoryVehicleStorage) GetVehicleByID(vehicleID string) (Vehicle, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	vehicle, exists := s.vehicles[vehicleID]
 	if !exists {
 		return Vehicle{}, fmt.Errorf("vehicle not found")
@@ -58,30 +78,87 @@ func (s *InMemoryVehicleStorage) GetVehicleByID(vehicleID string) (Vehicle, erro
 	return vehicle, nil
 }
 
+// GetAllVehicles returns a snapshot; changes to it do not affect the storage.
 func (s *InMemoryVehicleStorage) GetAllVehicles() map[string]Vehicle {
-	return s.vehicles
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	vehicles := make(map[string]Vehicle, len(s.vehicles))
+	for id, vehicle := range s.vehicles {
+		vehicles[id] = vehicle
+	}
+	return vehicles
+}
+
+//////
+
+// InMemoryPlaceStorage implements PlaceStorage using a map
+type InMemoryPlaceStorage struct {
+	mu     sync.RWMutex
+	places map[string]Location
+}
+
+func NewInMemoryPlaceStorage() PlaceStorage {
+	return &InMemoryPlaceStorage{places: make(map[string]Location)}
+}
+
+func (s *InMemoryPlaceStorage) AddPlace(place Location) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.places[place.Name]; exists {
+		return fmt.Errorf("place already exists")
+	}
+	s.places[place.Name] = place
+	return nil
+}
+
+func (s *InMemoryPlaceStorage) GetPlaceByName(name string) (Location, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	place, exists := s.places[name]
+	if !exists {
+		return Location{}, fmt.Errorf("place not found")
+	}
+	return place, nil
+}
+
+// GetAllPlaces returns a snapshot; changes to it do not affect the storage.
+func (s *InMemoryPlaceStorage) GetAllPlaces() map[string]Location {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	places := make(map[string]Location, len(s.places))
+	for name, place := range s.places {
+		places[name] = place
+	}
+	return places
 }
 
 //////
 
 // InMemoryRideStorage implements RideStorage using a map
 type InMemoryRideStorage struct {
+	mu    sync.RWMutex
 	rides map[string]Ride
+	index *rideIndex
 }
 
 func NewInMemoryRideStorage() RideStorage {
-	return &InMemoryRideStorage{rides: make(map[string]Ride)}
+	return &InMemoryRideStorage{rides: make(map[string]Ride), index: newRideIndex()}
 }
 
 func (s *InMemoryRideStorage) AddRide(ride Ride) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if _, exists := s.rides[ride.ID]; exists {
 		return fmt.Errorf("ride already exists")
 	}
 	s.rides[ride.ID] = ride
+	s.index.add(ride)
 	return nil
 }
 
 func (s *InMemoryRideStorage) GetRideByID(rideID string) (Ride, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	ride, exists := s.rides[rideID]
 	if !exists {
 		return Ride{}, fmt.Errorf("ride not found")
@@ -90,21 +167,243 @@ func (s *InMemoryRideStorage) GetRideByID(rideID string) (Ride, error) {
 }
 
 func (s *InMemoryRideStorage) UpdateRide(ride Ride) error {
-	if _, exists := s.rides[ride.ID]; !exists {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, exists := s.rides[ride.ID]
+	if !exists {
+		return fmt.Errorf("ride not found")
+	}
+	ride.Version = current.Version + 1
+	s.rides[ride.ID] = ride
+	s.index.replace(current, ride)
+	return nil
+}
+
+func (s *InMemoryRideStorage) CompareAndUpdateRide(ride Ride) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, exists := s.rides[ride.ID]
+	if !exists {
 		return fmt.Errorf("ride not found")
 	}
+	if current.Version != ride.Version {
+		return ErrVersionConflict
+	}
+	ride.Version++
 	s.rides[ride.ID] = ride
+	s.index.replace(current, ride)
 	return nil
 }
 
 func (s *InMemoryRideStorage) DeleteRide(rideID string) error {
-	if _, exists := s.rides[rideID]; !exists {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ride, exists := s.rides[rideID]
+	if !exists {
 		return fmt.Errorf("ride not found")
 	}
 	delete(s.rides, rideID)
+	s.index.remove(ride)
 	return nil
 }
 
+// GetAllRides returns a snapshot; changes to it do not affect the storage.
 func (s *InMemoryRideStorage) GetAllRides() map[string]Ride {
-	return s.rides
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rides := make(map[string]Ride, len(s.rides))
+	for id, ride := range s.rides {
+		rides[id] = ride
+	}
+	return rides
+}
+
+func (s *InMemoryRideStorage) GetRidesByDriver(driverID string) []Ride {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return ridesFor(s.rides, s.index.byDriver[driverID])
+}
+
+func (s *InMemoryRideStorage) GetRidesByVehicle(vehicleID string) []Ride {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return ridesFor(s.rides, s.index.byVehicle[vehicleID])
+}
+
+func (s *InMemoryRideStorage) GetRidesBySource(source string) []Ride {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return ridesFor(s.rides, s.index.bySource[source])
+}
+
+func (s *InMemoryRideStorage) GetRidesByRoute(source, destination string) []Ride {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return ridesFor(s.rides, s.index.byRoute[routeKey{source, destination}])
+}
+
+func (s *InMemoryRideStorage) GetRidesByStatus(status RideStatus) []Ride {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return ridesFor(s.rides, s.index.byStatus[status])
+}
+
+func (s *InMemoryRideStorage) GetRidesNear(center Location, radius float64) []Ride {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := s.index.grid.near(center, radius)
+	rides := make([]Ride, len(ids))
+	for i, id := range ids {
+		rides[i] = s.rides[id]
+	}
+	return rides
+}
+
+//////
+
+// InMemoryBookingStorage implements BookingStorage using a map
+type InMemoryBookingStorage struct {
+	mu       sync.RWMutex
+	bookings map[string]Booking
+	index    *bookingIndex
+}
+
+func NewInMemoryBookingStorage() BookingStorage {
+	return &InMemoryBookingStorage{bookings: make(map[string]Booking), index: newBookingIndex()}
+}
+
+func (s *InMemoryBookingStorage) AddBooking(booking Booking) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.bookings[booking.ID]; exists {
+		return fmt.Errorf("booking already exists")
+	}
+	s.bookings[booking.ID] = booking
+	s.index.add(booking)
+	return nil
+}
+
+func (s *InMemoryBookingStorage) GetBookingByID(bookingID string) (Booking, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	booking, exists := s.bookings[bookingID]
+	if !exists {
+		return Booking{}, fmt.Errorf("booking not found")
+	}
+	return booking, nil
+}
+
+func (s *InMemoryBookingStorage) UpdateBooking(booking Booking) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, exists := s.bookings[booking.ID]
+	if !exists {
+		return fmt.Errorf("booking not found")
+	}
+	s.bookings[booking.ID] = booking
+	s.index.replace(current, booking)
+	return nil
+}
+
+// GetAllBookings returns a snapshot; changes to it do not affect the storage.
+func (s *InMemoryBookingStorage) GetAllBookings() map[string]Booking {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	bookings := make(map[string]Booking, len(s.bookings))
+	for id, booking := range s.bookings {
+		bookings[id] = booking
+	}
+	return bookings
+}
+
+func (s *InMemoryBookingStorage) GetBookingsByRide(rideID string) []Booking {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return bookingsFor(s.bookings, s.index.byRide[rideID])
+}
+
+func (s *InMemoryBookingStorage) GetBookingsByPassenger(passengerID string) []Booking {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return bookingsFor(s.bookings, s.index.byPassenger[passengerID])
+}
+
+//////
+
+// InMemoryLedgerStorage implements LedgerStorage using maps, keeping a
+// running balance per account
+type InMemoryLedgerStorage struct {
+	mu           sync.RWMutex
+	transactions map[string]Transaction
+	byAccount    map[AccountID][]string // transaction IDs in the order added
+	balances     map[AccountID]Money
+}
+
+func NewInMemoryLedgerStorage() LedgerStorage {
+	return &InMemoryLedgerStorage{
+		transactions: make(map[string]Transaction),
+		byAccount:    make(map[AccountID][]string),
+		balances:     make(map[AccountID]Money),
+	}
+}
+
+func (s *InMemoryLedgerStorage) AddTransaction(tx Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.transactions[tx.ID]; exists {
+		return fmt.Errorf("transaction already exists")
+	}
+	tx.Postings = append([]Posting(nil), tx.Postings...)
+	s.transactions[tx.ID] = tx
+	for _, p := range tx.Postings {
+		if ids := s.byAccount[p.Account]; len(ids) == 0 || ids[len(ids)-1] != tx.ID {
+			s.byAccount[p.Account] = append(ids, tx.ID)
+		}
+		s.balances[p.Account] += p.Amount
+	}
+	return nil
+}
+
+func (s *InMemoryLedgerStorage) GetTransactionByID(txID string) (Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tx, exists := s.transactions[txID]
+	if !exists {
+		return Transaction{}, fmt.Errorf("transaction not found")
+	}
+	return tx, nil
+}
+
+func (s *InMemoryLedgerStorage) GetTransactionsByAccount(account AccountID) []Transaction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := s.byAccount[account]
+	transactions := make([]Transaction, len(ids))
+	for i, id := range ids {
+		transactions[i] = s.transactions[id]
+	}
+	return transactions
+}
+
+func (s *InMemoryLedgerStorage) TransactionCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.transactions)
+}
+
+func (s *InMemoryLedgerStorage) GetBalance(account AccountID) Money {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.balances[account]
+}
+
+// GetAllBalances returns a snapshot; changes to it do not affect the storage.
+func (s *InMemoryLedgerStorage) GetAllBalances() map[AccountID]Money {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	balances := make(map[AccountID]Money, len(s.balances))
+	for account, balance := range s.balances {
+		balances[account] = balance
+	}
+	return balances
 }
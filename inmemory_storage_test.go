@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Test that GetAllRides returns a copy of the internal state
+func TestGetAllRidesReturnsSnapshot(t *testing.T) {
+	rideStorage := NewInMemoryRideStorage()
+	ride := Ride{ID: "1", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 3}
+	_ = rideStorage.AddRide(ride)
+
+	rides := rideStorage.GetAllRides()
+	delete(rides, ride.ID)
+	rides["2"] = Ride{ID: "2"}
+
+	if _, err := rideStorage.GetRideByID(ride.ID); err != nil {
+		t.Fatalf("Expected ride to still exist, but got error %v", err)
+	}
+	if _, err := rideStorage.GetRideByID("2"); err == nil {
+		t.Fatalf("Expected ride 2 not to be stored")
+	}
+}
+
+// Test concurrent writers and readers on every in-memory store; run with -race
+func TestInMemoryStorageConcurrentAccess(t *testing.T) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprint(i)
+			_ = userStorage.AddUser(User{ID: id})
+			_ = vehicleStorage.AddVehicle(Vehicle{ID: id})
+			_ = rideStorage.AddRide(Ride{ID: id, AvailableSeats: 1})
+			_ = rideStorage.UpdateRide(Ride{ID: id, AvailableSeats: 0})
+			_ = userStorage.GetAllUsers()
+			_ = vehicleStorage.GetAllVehicles()
+			_ = rideStorage.GetAllRides()
+			_ = rideStorage.GetRidesByStatus("")
+			_ = rideStorage.DeleteRide(id)
+		}(i)
+	}
+	wg.Wait()
+
+	if len(userStorage.GetAllUsers()) != 100 || len(vehicleStorage.GetAllVehicles()) != 100 {
+		t.Fatalf("Expected 100 users and vehicles")
+	}
+	if len(rideStorage.GetAllRides()) != 0 || len(rideStorage.GetRidesByStatus("")) != 0 {
+		t.Fatalf("Expected all rides to be deleted")
+	}
+}
+
+// Test that the indexed queries follow adds, updates and deletes
+func TestRideStorageIndexes(t *testing.T) {
+	fileStorage, err := NewFileRideStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	defer fileStorage.Close()
+
+	for _, storage := range []RideStorage{NewInMemoryRideStorage(), fileStorage} {
+		_ = storage.AddRide(Ride{ID: "2", DriverID: "d1", VehicleID: "v1", Source: "A", Destination: "B", Status: RideOffered})
+		_ = storage.AddRide(Ride{ID: "1", DriverID: "d1", VehicleID: "v2", Source: "A", Destination: "C", Status: RideOffered})
+		_ = storage.AddRide(Ride{ID: "3", DriverID: "d2", VehicleID: "v1", Source: "B", Destination: "C", Status: RideOffered})
+
+		ride, _ := storage.GetRideByID("1")
+		ride.DriverID, ride.Destination, ride.Status = "d2", "B", RideInProgress
+		if err := storage.CompareAndUpdateRide(ride); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if err := storage.DeleteRide("3"); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+
+		tests := []struct {
+			name     string
+			rides    []Ride
+			expected string
+		}{
+			{name: "driver d1", rides: storage.GetRidesByDriver("d1"), expected: "[2]"},
+			{name: "driver d2", rides: storage.GetRidesByDriver("d2"), expected: "[1]"},
+			{name: "vehicle v1", rides: storage.GetRidesByVehicle("v1"), expected: "[2]"},
+			{name: "source A", rides: storage.GetRidesBySource("A"), expected: "[1 2]"},
+			{name: "source B", rides: storage.GetRidesBySource("B"), expected: "[]"},
+			{name: "route A-B", rides: storage.GetRidesByRoute("A", "B"), expected: "[1 2]"},
+			{name: "route A-C", rides: storage.GetRidesByRoute("A", "C"), expected: "[]"},
+			{name: "offered", rides: storage.GetRidesByStatus(RideOffered), expected: "[2]"},
+			{name: "in progress", rides: storage.GetRidesByStatus(RideInProgress), expected: "[1]"},
+		}
+		for _, tt := range tests {
+			if got := fmt.Sprint(Booking{Legs: tt.rides}.RideIDs()); got != tt.expected {
+				t.Fatalf("%s: expected rides %s, but got %s", tt.name, tt.expected, got)
+			}
+		}
+		if rides := storage.GetRidesByRoute("A", "B"); rides[0].Version != 1 {
+			t.Fatalf("Expected the indexed query to return the updated ride, but got %+v", rides[0])
+		}
+	}
+}
+
+// Test that booking lookups by ride and passenger follow adds and updates
+func TestBookingStorageIndexes(t *testing.T) {
+	dir := t.TempDir()
+	fileStorage, err := NewFileBookingStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	for _, storage := range []BookingStorage{NewInMemoryBookingStorage(), fileStorage} {
+		_ = storage.AddBooking(Booking{ID: "B2", PassengerID: "p1", Legs: []Ride{{ID: "1"}, {ID: "2"}}})
+		_ = storage.AddBooking(Booking{ID: "B1", PassengerID: "p1", Legs: []Ride{{ID: "1"}}})
+		_ = storage.AddBooking(Booking{ID: "B3", PassengerID: "p2", Legs: []Ride{{ID: "2"}}})
+
+		booking, _ := storage.GetBookingByID("B2")
+		booking.Legs, booking.DroppedLegs = booking.Legs[:1], booking.Legs[1:]
+		if err := storage.UpdateBooking(booking); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+
+		tests := []struct {
+			name     string
+			bookings []Booking
+			expected string
+		}{
+			{name: "ride 1", bookings: storage.GetBookingsByRide("1"), expected: "[B1 B2]"},
+			{name: "ride 2", bookings: storage.GetBookingsByRide("2"), expected: "[B3]"},
+			{name: "ride 3", bookings: storage.GetBookingsByRide("3"), expected: "[]"},
+			{name: "passenger p1", bookings: storage.GetBookingsByPassenger("p1"), expected: "[B1 B2]"},
+			{name: "passenger p2", bookings: storage.GetBookingsByPassenger("p2"), expected: "[B3]"},
+		}
+		for _, tt := range tests {
+			var ids []string
+			for _, booking := range tt.bookings {
+				ids = append(ids, booking.ID)
+			}
+			if got := fmt.Sprint(ids); got != tt.expected {
+				t.Fatalf("%s: expected bookings %s, but got %s", tt.name, tt.expected, got)
+			}
+		}
+	}
+
+	fileStorage.Close()
+	reopened, err := NewFileBookingStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	defer reopened.Close()
+	if bookings := reopened.GetBookingsByRide("2"); len(bookings) != 1 || bookings[0].ID != "B3" {
+		t.Fatalf("Expected the reopened storage to index ride 2 as [B3], but got %v", bookings)
+	}
+}
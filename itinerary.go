@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// itineraryTTL is how long a search result can be booked by its ID.
+const itineraryTTL = 15 * time.Minute
+
+// ItineraryLeg is one ride of an itinerary with the details shown to the
+// passenger when comparing options.
+type ItineraryLeg struct {
+	Ride         Ride
+	VehicleModel string
+	Distance     float64               // km through the leg's stops; zero when a place has no coordinates
+	Fare         float64               // per seat
+	Segments     []SegmentAvailability // free seats along the ride's whole route, stop to stop
+}
+
+// Itinerary is one bookable option returned by SearchItineraries: a direct
+// ride or a chain of rides.
+type Itinerary struct {
+	ID              string
+	Legs            []ItineraryLeg
+	Seats           int // seats the search asked for
+	AvailableSeats  int // fewest free seats on any leg
+	Transfers       []Transfer
+	JourneyTime     time.Duration
+	Price           float64 // for all requested seats
+	SurgeMultiplier float64 // applied to scheduled leg fares; 1 when demand is normal
+	ExpiresAt       time.Time
+	Degraded        string // why the vehicle preference was relaxed; empty if it was met
+}
+
+// Rides returns the itinerary's rides in travel order.
+func (it Itinerary) Rides() []Ride {
+	rides := make([]Ride, len(it.Legs))
+	for i, leg := range it.Legs {
+		rides[i] = leg.Ride
+	}
+	return rides
+}
+
+// SearchItineraries returns up to k ranked options from source to destination,
+// best first by opts.Objective. If no route meets opts.Vehicle and it allows
+// degrading, the preference is relaxed until one does. Nothing is reserved;
+// pass an option's ID to BookItinerary before it expires to book it.
+func (rm *rideManager) SearchItineraries(source, destination string, seats, k int, opts RouteOptions) ([]Itinerary, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("number of itineraries must be positive")
+	}
+	rm.recordSearch(source, destination)
+	routes, err := rm.findRoutes(source, destination, seats, k, opts)
+	var reasons []string
+	for err == nil && len(routes) == 0 && opts.Vehicle.Degrade {
+		relaxed, reason, ok := opts.Vehicle.relax()
+		if !ok {
+			break
+		}
+		opts.Vehicle, reasons = relaxed, append(reasons, reason)
+		routes, err = rm.findRoutes(source, destination, seats, k, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	surge := rm.surgeMultiplier(source, destination)
+	itineraries := make([]Itinerary, 0, len(routes))
+	for _, route := range routes {
+		it := rm.newItinerary(route.legs, seats, surge)
+		it.Degraded = strings.Join(reasons, "; ")
+		itineraries = append(itineraries, it)
+	}
+
+	now := rm.now()
+	rm.itineraryMu.Lock()
+	defer rm.itineraryMu.Unlock()
+	for id, it := range rm.itineraries {
+		if now.After(it.ExpiresAt) {
+			delete(rm.itineraries, id)
+		}
+	}
+	for _, it := range itineraries {
+		rm.itineraries[it.ID] = it
+	}
+	return itineraries, nil
+}
+
+// BookItinerary reserves every leg of an itinerary returned by
+// SearchItineraries, or none of them, and records the booking. An itinerary
+// can be booked once: it is claimed while booking, and one that fails to book
+// is put back so it can be tried again until it expires.
+func (rm *rideManager) BookItinerary(userID, itineraryID string) (Booking, error) {
+	rm.itineraryMu.Lock()
+	it, exists := rm.itineraries[itineraryID]
+	delete(rm.itineraries, itineraryID)
+	rm.itineraryMu.Unlock()
+	if !exists {
+		return Booking{}, fmt.Errorf("itinerary %s not found", itineraryID)
+	}
+	booking, err := rm.bookItinerary(userID, it)
+	if err != nil {
+		rm.itineraryMu.Lock()
+		rm.itineraries[itineraryID] = it
+		rm.itineraryMu.Unlock()
+		return Booking{}, fmt.Errorf("could not book itinerary %s: %w", itineraryID, err)
+	}
+	fmt.Printf("Itinerary booked: %v as %v\n", itineraryID, booking.ID)
+	booking.printConfirmation()
+	return booking, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that searching returns ranked direct and multi-leg options without reserving seats
+func TestSearchItineraries(t *testing.T) {
+	rideMgr, rideStorage := newRoutingFixture(t)
+	now := rideMgr.now()
+	_ = rideMgr.userMgr.AddUser(User{ID: "AD", Name: "DriverAD", Role: Driver})
+	_ = rideMgr.vehicleMgr.AddVehicle(Vehicle{ID: "AD", OwnerID: "AD", Model: "Toyota", Capacity: 4})
+	_ = rideMgr.OfferRide(Ride{ID: "AD", DriverID: "AD", VehicleID: "AD", Source: "A", Destination: "D", AvailableSeats: 3,
+		DepartureTime: now.Add(time.Hour), ArrivalTime: now.Add(7 * time.Hour)})
+	rideMgr.SetFareFunc(func(Ride) float64 { return 10 })
+
+	itineraries, err := rideMgr.SearchItineraries("A", "D", 2, 5, RouteOptions{Objective: FewestTransfers})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	var got []string
+	for _, it := range itineraries {
+		got = append(got, fmt.Sprint(Booking{Legs: it.Rides()}.RideIDs()))
+	}
+	if fmt.Sprint(got) != "[[AD] [AE ED] [AB BC CD]]" {
+		t.Fatalf("Expected options [AD], [AE ED], [AB BC CD], but got %v", got)
+	}
+
+	direct := itineraries[0]
+	if direct.Legs[0].VehicleModel != "Toyota" || direct.AvailableSeats != 3 || direct.Price != 20 || len(direct.Transfers) != 0 {
+		t.Fatalf("Unexpected direct option %+v", direct)
+	}
+	longest := itineraries[2]
+	if longest.Price != 60 || len(longest.Transfers) != 2 || longest.JourneyTime != 80*time.Minute {
+		t.Fatalf("Unexpected three-leg option %+v", longest)
+	}
+
+	for _, ride := range rideStorage.GetAllRides() {
+		if ride.AvailableSeats != 4 && ride.ID != "AD" {
+			t.Fatalf("Expected search not to reserve seats, but ride %s has %d", ride.ID, ride.AvailableSeats)
+		}
+	}
+}
+
+// Test booking a chosen itinerary by ID, once, and before it expires
+func TestBookItinerary(t *testing.T) {
+	rideMgr, rideStorage := newRoutingFixture(t)
+	clock := rideMgr.now()
+	rideMgr.now = func() time.Time { return clock }
+
+	itineraries, err := rideMgr.SearchItineraries("A", "D", 2, 2, RouteOptions{Objective: FewestTransfers})
+	if err != nil || len(itineraries) != 2 {
+		t.Fatalf("Expected 2 itineraries, but got %d (%v)", len(itineraries), err)
+	}
+
+	chosen := itineraries[1]
+	booking, err := rideMgr.BookItinerary("p1", chosen.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if fmt.Sprint(booking.RideIDs()) != "[AB BC CD]" || booking.Seats != 2 {
+		t.Fatalf("Unexpected booking %+v", booking)
+	}
+	for _, id := range []string{"AB", "BC", "CD"} {
+		ride, _ := rideStorage.GetRideByID(id)
+		if ride.AvailableSeats != 2 {
+			t.Fatalf("Expected 2 seats left on ride %s, but got %d", id, ride.AvailableSeats)
+		}
+	}
+	if _, err := rideMgr.BookItinerary("p1", chosen.ID); err == nil {
+		t.Fatalf("Expected error booking the same itinerary twice")
+	}
+
+	clock = clock.Add(itineraryTTL + time.Minute)
+	if _, err := rideMgr.BookItinerary("p2", itineraries[0].ID); err == nil {
+		t.Fatalf("Expected error booking an expired itinerary")
+	}
+}
+
+// Test that an itinerary which loses its seats can be booked once they are
+// free again
+func TestBookItineraryRetry(t *testing.T) {
+	rideMgr, _ := newRoutingFixture(t)
+
+	itineraries, err := rideMgr.SearchItineraries("A", "D", 2, 1, RouteOptions{Objective: FewestTransfers})
+	if err != nil || len(itineraries) != 1 {
+		t.Fatalf("Expected 1 itinerary, but got %d (%v)", len(itineraries), err)
+	}
+	first := itineraries[0].Legs[0].Ride
+	taken, err := rideMgr.SelectRide("p2", first.Source, first.Destination, 3, string(MostVacantSeats))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if _, err := rideMgr.BookItinerary("p1", itineraries[0].ID); err == nil {
+		t.Fatalf("Expected error booking an itinerary whose seats are gone")
+	}
+	if err := rideMgr.CancelBooking(taken.ID, "plans changed"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if _, err := rideMgr.BookItinerary("p1", itineraries[0].ID); err != nil {
+		t.Fatalf("Expected the itinerary to be bookable again, but got %v", err)
+	}
+}
+
+// Test that concurrent attempts to book one itinerary book it exactly once
+func TestBookItineraryConcurrent(t *testing.T) {
+	rideMgr, rideStorage := newRoutingFixture(t)
+
+	itineraries, err := rideMgr.SearchItineraries("A", "D", 1, 1, RouteOptions{Objective: FewestTransfers})
+	if err != nil || len(itineraries) != 1 {
+		t.Fatalf("Expected 1 itinerary, but got %d (%v)", len(itineraries), err)
+	}
+	// A slow clock widens the window between looking the itinerary up and
+	// booking it.
+	clock := rideMgr.now()
+	rideMgr.now = func() time.Time {
+		time.Sleep(time.Millisecond)
+		return clock
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		booked int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := rideMgr.BookItinerary(fmt.Sprintf("p%d", i), itineraries[0].ID); err == nil {
+				mu.Lock()
+				booked++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if booked != 1 {
+		t.Fatalf("Expected the itinerary to be booked once, but it was booked %d times", booked)
+	}
+	for _, leg := range itineraries[0].Legs {
+		ride, _ := rideStorage.GetRideByID(leg.Ride.ID)
+		if ride.AvailableSeats != 3 {
+			t.Fatalf("Expected 3 seats left on ride %s, but got %d", ride.ID, ride.AvailableSeats)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Transfer is a change of ride at an intermediate place of a journey.
+type Transfer struct {
+	Place string
+	Wait  time.Duration // zero when either ride is unscheduled
+}
+
+// layoverLimits bounds the wait between arriving on one leg and departing on
+// the next. A zero Max means there is no upper bound.
+type layoverLimits struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// SetLayoverLimits sets the minimum and maximum wait allowed at each transfer
+// of an indirect route. A zero max removes the upper bound.
+func (rm *rideManager) SetLayoverLimits(min, max time.Duration) error {
+	if min < 0 {
+		return fmt.Errorf("minimum layover must not be negative, got %v", min)
+	}
+	if max != 0 && max < min {
+		return fmt.Errorf("maximum layover %v is below the minimum %v", max, min)
+	}
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.layovers = layoverLimits{Min: min, Max: max}
+	return nil
+}
+
+// connects reports whether a passenger arriving on prev can catch next. Legs
+// without times can't be checked and always connect.
+func (l layoverLimits) connects(prev, next Ride) bool {
+	if !prev.IsScheduled() || !next.IsScheduled() {
+		return true
+	}
+	wait := next.DepartureTime.Sub(prev.ArrivalTime)
+	if wait < l.Min {
+		return false
+	}
+	return l.Max == 0 || wait <= l.Max
+}
+
+// journeyTiming returns the time from the first departure to the last arrival
+// and the transfers between consecutive legs. The journey time is zero unless
+// every leg is scheduled.
+func journeyTiming(legs []Ride) (time.Duration, []Transfer) {
+	var transfers []Transfer
+	scheduled := len(legs) > 0
+	for i, leg := range legs {
+		if !leg.IsScheduled() {
+			scheduled = false
+		}
+		if i == 0 {
+			continue
+		}
+		transfer := Transfer{Place: leg.Source}
+		if prev := legs[i-1]; prev.IsScheduled() && leg.IsScheduled() {
+			transfer.Wait = leg.DepartureTime.Sub(prev.ArrivalTime)
+		}
+		transfers = append(transfers, transfer)
+	}
+	if !scheduled {
+		return 0, transfers
+	}
+	return legs[len(legs)-1].ArrivalTime.Sub(legs[0].DepartureTime), transfers
+}
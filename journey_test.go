@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that indirect routes only chain legs within the layover limits
+func TestIndirectRouteRespectsLayovers(t *testing.T) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	rideMgr.now = func() time.Time { return now }
+	if err := rideMgr.SetLayoverLimits(15*time.Minute, 2*time.Hour); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	for _, id := range []string{"1", "2", "3", "4"} {
+		_ = userMgr.AddUser(User{ID: id, Name: "Driver" + id, Role: Driver})
+		_ = vehicleMgr.AddVehicle(Vehicle{ID: id, OwnerID: id, Model: "XUV", Capacity: 7})
+	}
+	at := func(hour, minute int) time.Time {
+		return now.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+	rides := []Ride{
+		{ID: "AB", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4, DepartureTime: at(1, 0), ArrivalTime: at(2, 0)},
+		{ID: "BC-early", DriverID: "2", VehicleID: "2", Source: "B", Destination: "C", AvailableSeats: 4, DepartureTime: at(1, 30), ArrivalTime: at(2, 30)},
+		{ID: "BC-tight", DriverID: "3", VehicleID: "3", Source: "B", Destination: "C", AvailableSeats: 4, DepartureTime: at(2, 5), ArrivalTime: at(3, 0)},
+		{ID: "BC-ok", DriverID: "4", VehicleID: "4", Source: "B", Destination: "C", AvailableSeats: 4, DepartureTime: at(2, 30), ArrivalTime: at(3, 30)},
+	}
+	for _, ride := range rides {
+		if err := rideMgr.OfferRide(ride); err != nil {
+			t.Fatalf("Error offering ride: %v", err)
+		}
+	}
+
+	booking, err := rideMgr.SelectRide("5", "A", "C", 1, string(MostVacantSeats))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if ids := booking.RideIDs(); len(ids) != 2 || ids[1] != "BC-ok" {
+		t.Fatalf("Expected to connect to BC-ok, but got %v", ids)
+	}
+	if len(booking.Transfers) != 1 || booking.Transfers[0].Place != "B" || booking.Transfers[0].Wait != 30*time.Minute {
+		t.Fatalf("Expected a 30m transfer at B, but got %+v", booking.Transfers)
+	}
+	if booking.JourneyTime != 150*time.Minute {
+		t.Fatalf("Expected a journey time of 2h30m, but got %v", booking.JourneyTime)
+	}
+
+	if err := rideMgr.SetLayoverLimits(0, 20*time.Minute); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	booking, err = rideMgr.SelectRide("6", "A", "C", 1, string(MostVacantSeats))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if ids := booking.RideIDs(); len(ids) != 2 || ids[1] != "BC-tight" {
+		t.Fatalf("Expected to connect to BC-tight, but got %v", ids)
+	}
+}
+
+// Test that layover limits which would let legs overlap or rule out every
+// connection are rejected
+func TestSetLayoverLimitsValidates(t *testing.T) {
+	rideMgr := NewRideManager(NewInMemoryRideStorage(), NewInMemoryBookingStorage(), nil, nil)
+	if err := rideMgr.SetLayoverLimits(-time.Minute, 0); err == nil {
+		t.Fatalf("Expected an error for a negative minimum, but got nil")
+	}
+	if err := rideMgr.SetLayoverLimits(time.Hour, 30*time.Minute); err == nil {
+		t.Fatalf("Expected an error for a maximum below the minimum, but got nil")
+	}
+	if err := rideMgr.SetLayoverLimits(time.Hour, 0); err != nil {
+		t.Fatalf("Expected no upper bound to be allowed, but got %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Money is an amount in hundredths of the currency unit, so postings add up
+// exactly.
+type Money int64
+
+// toMoney converts a fare to Money, rounding to the nearest hundredth.
+func toMoney(amount float64) Money {
+	return Money(math.Round(amount * 100))
+}
+
+func (m Money) String() string {
+	return fmt.Sprintf("%.2f", float64(m)/100)
+}
+
+// AccountID names a ledger account: a user's wallet or one of the platform's
+// own accounts.
+type AccountID string
+
+const (
+	EscrowAccount       AccountID = "platform:escrow" // passenger payments held until the ride is completed
+	PlatformFeesAccount AccountID = "platform:fees"   // the platform's cut of driver earnings
+	ExternalAccount     AccountID = "external"        // money entering and leaving through top-ups and withdrawals
+)
+
+// WalletAccount returns the account of a user's wallet.
+func WalletAccount(userID string) AccountID {
+	return AccountID("wallet:" + userID)
+}
+
+type TransactionKind string
+
+const (
+	TopUp          TransactionKind = "Top Up"
+	Withdrawal     TransactionKind = "Withdrawal"
+	BookingCharge  TransactionKind = "Booking Charge"
+	DriverEarnings TransactionKind = "Driver Earnings"
+	PlatformFee    TransactionKind = "Platform Fee"
+	Refund         TransactionKind = "Refund"
+)
+
+// Posting credits Amount to an account; a negative Amount debits it.
+type Posting struct {
+	Account AccountID
+	Amount  Money
+}
+
+// Transaction is a set of postings that sum to zero, so money only ever
+// moves between accounts.
+type Transaction struct {
+	ID        string
+	Seq       int64 // position in the ledger, from 1
+	Kind      TransactionKind
+	Reference string // booking or ride the transaction is for, if any
+	Memo      string
+	Postings  []Posting
+	CreatedAt time.Time
+}
+
+// amountFor returns the net amount the transaction posts to account.
+func (tx Transaction) amountFor(account AccountID) Money {
+	var amount Money
+	for _, p := range tx.Postings {
+		if p.Account == account {
+			amount += p.Amount
+		}
+	}
+	return amount
+}
+
+// validate checks that tx is balanced and every posting names an account.
+func (tx Transaction) validate() error {
+	if len(tx.Postings) < 2 {
+		return fmt.Errorf("transaction must have at least two postings")
+	}
+	var sum Money
+	for _, p := range tx.Postings {
+		if p.Account == "" {
+			return fmt.Errorf("posting without an account")
+		}
+		if p.Amount == 0 {
+			return fmt.Errorf("posting of zero to %s", p.Account)
+		}
+		sum += p.Amount
+	}
+	if sum != 0 {
+		return fmt.Errorf("postings sum to %v, not zero", sum)
+	}
+	return nil
+}
+
+// StatementEntry is one transaction as it affected an account.
+type StatementEntry struct {
+	TransactionID string
+	Kind          TransactionKind
+	Reference     string
+	Memo          string
+	Amount        Money // credited to the account; negative when debited
+	Balance       Money // after the transaction
+	CreatedAt     time.Time
+}
+
+type ledgerManager struct {
+	mu      sync.Mutex // serializes postings so sequence numbers follow storage order
+	storage LedgerStorage
+	seq     int64
+	now     func() time.Time
+}
+
+func NewLedgerManager(storage LedgerStorage) *ledgerManager {
+	return &ledgerManager{storage: storage, seq: int64(storage.TransactionCount()), now: time.Now}
+}
+
+// Post records a balanced transaction, numbering it and stamping it with the
+// current time unless CreatedAt is set.
+func (lm *ledgerManager) Post(tx Transaction) (Transaction, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.post(tx)
+}
+
+// post is Post for callers holding lm.mu.
+func (lm *ledgerManager) post(tx Transaction) (Transaction, error) {
+	if err := tx.validate(); err != nil {
+		return Transaction{}, fmt.Errorf("invalid %s transaction: %v", tx.Kind, err)
+	}
+	tx.Seq = lm.seq + 1
+	tx.ID = fmt.Sprintf("T%d", tx.Seq)
+	if tx.CreatedAt.IsZero() {
+		tx.CreatedAt = lm.now()
+	}
+	if err := lm.storage.AddTransaction(tx); err != nil {
+		return Transaction{}, fmt.Errorf("could not post %s transaction: %v", tx.Kind, err)
+	}
+	lm.seq = tx.Seq
+	return tx, nil
+}
+
+// TopUp moves money into a user's wallet from outside the platform.
+func (lm *ledgerManager) TopUp(userID string, amount Money) (Transaction, error) {
+	if amount <= 0 {
+		return Transaction{}, fmt.Errorf("top-up amount must be positive")
+	}
+	return lm.Post(Transaction{Kind: TopUp, Postings: []Posting{
+		{Account: ExternalAccount, Amount: -amount},
+		{Account: WalletAccount(userID), Amount: amount},
+	}})
+}
+
+// Charge posts tx, which debits userID's wallet, only if the wallet covers the
+// debit.
+func (lm *ledgerManager) Charge(userID string, tx Transaction) (Transaction, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if debit := -tx.amountFor(WalletAccount(userID)); debit > lm.Balance(userID) {
+		return Transaction{}, fmt.Errorf("insufficient balance: %v available, %v needed", lm.Balance(userID), debit)
+	}
+	return lm.post(tx)
+}
+
+// Withdraw pays money out of a user's wallet. A wallet may go negative when a
+// split-cost share rises after booking, but never by withdrawing.
+func (lm *ledgerManager) Withdraw(userID string, amount Money) (Transaction, error) {
+	if amount <= 0 {
+		return Transaction{}, fmt.Errorf("withdrawal amount must be positive")
+	}
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if balance := lm.Balance(userID); balance < amount {
+		return Transaction{}, fmt.Errorf("insufficient balance: %v available", balance)
+	}
+	return lm.post(Transaction{Kind: Withdrawal, Postings: []Posting{
+		{Account: WalletAccount(userID), Amount: -amount},
+		{Account: ExternalAccount, Amount: amount},
+	}})
+}
+
+// Balance returns the balance of a user's wallet.
+func (lm *ledgerManager) Balance(userID string) Money {
+	return lm.storage.GetBalance(WalletAccount(userID))
+}
+
+// Statement lists every transaction on a user's wallet, oldest first, with
+// the balance after each.
+func (lm *ledgerManager) Statement(userID string) []StatementEntry {
+	account := WalletAccount(userID)
+	var balance Money
+	var statement []StatementEntry
+	for _, tx := range lm.storage.GetTransactionsByAccount(account) {
+		amount := tx.amountFor(account)
+		balance += amount
+		statement = append(statement, StatementEntry{
+			TransactionID: tx.ID,
+			Kind:          tx.Kind,
+			Reference:     tx.Reference,
+			Memo:          tx.Memo,
+			Amount:        amount,
+			Balance:       balance,
+			CreatedAt:     tx.CreatedAt,
+		})
+	}
+	return statement
+}
+
+// CheckBalanced verifies that the balances of all accounts sum to zero.
+func (lm *ledgerManager) CheckBalanced() error {
+	var sum Money
+	for _, balance := range lm.storage.GetAllBalances() {
+		sum += balance
+	}
+	if sum != 0 {
+		return fmt.Errorf("ledger is out of balance by %v", sum)
+	}
+	return nil
+}
+
+// PrintWalletBalances prints the balance of every wallet with postings.
+func (lm *ledgerManager) PrintWalletBalances() {
+	balances := lm.storage.GetAllBalances()
+	accounts := make([]string, 0, len(balances))
+	for account := range balances {
+		if strings.HasPrefix(string(account), string(WalletAccount(""))) {
+			accounts = append(accounts, string(account))
+		}
+	}
+	sort.Strings(accounts)
+	fmt.Println("Wallet balances:")
+	for _, account := range accounts {
+		fmt.Printf("%s: %v\n", strings.TrimPrefix(account, string(WalletAccount(""))), balances[AccountID(account)])
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that only balanced transactions can be posted
+func TestLedgerRejectsUnbalancedTransactions(t *testing.T) {
+	ledger := NewLedgerManager(NewInMemoryLedgerStorage())
+	tests := [][]Posting{
+		nil,
+		{{Account: WalletAccount("1"), Amount: 100}},
+		{{Account: WalletAccount("1"), Amount: 100}, {Account: ExternalAccount, Amount: -90}},
+		{{Account: WalletAccount("1"), Amount: 0}, {Account: ExternalAccount, Amount: 0}},
+		{{Account: "", Amount: 100}, {Account: ExternalAccount, Amount: -100}},
+	}
+	for _, postings := range tests {
+		if _, err := ledger.Post(Transaction{Kind: TopUp, Postings: postings}); err == nil {
+			t.Fatalf("Expected an error posting %v, but got nil", postings)
+		}
+	}
+	if err := ledger.CheckBalanced(); err != nil {
+		t.Fatalf("Expected an empty ledger to balance, but got %v", err)
+	}
+}
+
+// Test wallet top-ups, withdrawals and statements
+func TestWalletStatement(t *testing.T) {
+	ledger := NewLedgerManager(NewInMemoryLedgerStorage())
+	if _, err := ledger.TopUp("1", 500_00); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if _, err := ledger.Withdraw("1", 200_00); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if _, err := ledger.Withdraw("1", 1000_00); err == nil {
+		t.Fatalf("Expected an error withdrawing more than the balance, but got nil")
+	}
+	if _, err := ledger.TopUp("1", -5); err == nil {
+		t.Fatalf("Expected an error topping up a negative amount, but got nil")
+	}
+
+	if balance := ledger.Balance("1"); balance != 300_00 {
+		t.Fatalf("Expected a balance of 300.00, but got %v", balance)
+	}
+	statement := ledger.Statement("1")
+	if len(statement) != 2 {
+		t.Fatalf("Expected 2 statement entries, but got %d", len(statement))
+	}
+	if e := statement[1]; e.Kind != Withdrawal || e.Amount != -200_00 || e.Balance != 300_00 || e.TransactionID != "T2" {
+		t.Fatalf("Expected a withdrawal of 200.00 leaving 300.00, but got %+v", e)
+	}
+	if err := ledger.CheckBalanced(); err != nil {
+		t.Fatalf("Expected the ledger to balance, but got %v", err)
+	}
+}
+
+// Test that a booking is charged into escrow and paid to the driver, less the
+// platform fee, when the ride completes
+func TestBookingPayments(t *testing.T) {
+	rideMgr := newStrategyFixture(t)
+	rideMgr.SetFareFunc(func(Ride) float64 { return 100 })
+	ledger := NewLedgerManager(NewInMemoryLedgerStorage())
+	if err := rideMgr.SetLedger(ledger, 1.5); err == nil {
+		t.Fatalf("Expected an error for a fee above 1, but got nil")
+	}
+	if err := rideMgr.SetLedger(ledger, 0.1); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if _, err := ledger.TopUp("passenger", 1000_00); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if _, err := rideMgr.SelectRide("broke", "A", "B", 2, ""); err == nil {
+		t.Fatalf("Expected an error booking without the funds, but got nil")
+	}
+	booking, err := rideMgr.SelectRide("passenger", "A", "B", 2, "")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	escrow := func() Money { return ledger.storage.GetBalance(EscrowAccount) }
+	if ledger.Balance("passenger") != 800_00 || escrow() != 200_00 {
+		t.Fatalf("Expected 200.00 moved to escrow, but the wallet has %v and escrow %v", ledger.Balance("passenger"), escrow())
+	}
+
+	driverID := booking.Legs[0].DriverID
+	if err := rideMgr.StartRide(booking.Legs[0].ID); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := rideMgr.EndRide(booking.Legs[0].ID); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	fees := ledger.storage.GetBalance(PlatformFeesAccount)
+	if ledger.Balance(driverID) != 180_00 || fees != 20_00 || escrow() != 0 {
+		t.Fatalf("Expected 180.00 to the driver and 20.00 in fees, but got %v and %v with %v left in escrow", ledger.Balance(driverID), fees, escrow())
+	}
+	if err := ledger.CheckBalanced(); err != nil {
+		t.Fatalf("Expected the ledger to balance, but got %v", err)
+	}
+}
+
+// Test that split-cost shares are charged and refunded as they change
+func TestSplitCostPayments(t *testing.T) {
+	rideMgr := newStrategyFixture(t)
+	ledger := NewLedgerManager(NewInMemoryLedgerStorage())
+	if err := rideMgr.SetLedger(ledger, 0); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	for _, passengerID := range []string{"p1", "p2"} {
+		if _, err := ledger.TopUp(passengerID, 300_00); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+	}
+	departure := rideMgr.now().Add(5 * time.Hour)
+	ride := Ride{ID: "4", DriverID: "1", VehicleID: "1", Source: "C", Destination: "D", AvailableSeats: 4, Pricing: SplitCost, TripCost: 300, DepartureTime: departure, ArrivalTime: departure.Add(time.Hour)}
+	if err := rideMgr.OfferRide(ride); err != nil {
+		t.Fatalf("Error offering ride: %v", err)
+	}
+	if _, err := rideMgr.SelectRide("p1", "C", "D", 1, ""); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if _, err := rideMgr.SelectRide("p2", "C", "D", 2, ""); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if ledger.Balance("p1") != 225_00 || ledger.Balance("p2") != 150_00 {
+		t.Fatalf("Expected p1 to have paid 75.00 and p2 150.00, but got %v and %v", ledger.Balance("p1"), ledger.Balance("p2"))
+	}
+	statement := ledger.Statement("p1")
+	if len(statement) != 3 || statement[2].Kind != Refund || statement[2].Amount != 75_00 {
+		t.Fatalf("Expected p1 to be refunded 75.00 when the share dropped, but got %+v", statement)
+	}
+
+	if err := rideMgr.StartRide("4"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := rideMgr.EndRide("4"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if ledger.Balance("1") != 225_00 {
+		t.Fatalf("Expected the driver to receive 225.00, but got %v", ledger.Balance("1"))
+	}
+	if err := ledger.CheckBalanced(); err != nil {
+		t.Fatalf("Expected the ledger to balance, but got %v", err)
+	}
+}
+
+// Test that a booking is refused, and no share changes, when a co-passenger's
+// share can't be repriced
+func TestSplitCostRepriceFails(t *testing.T) {
+	rideMgr := newStrategyFixture(t)
+	ledger := NewLedgerManager(&failingLedgerStorage{LedgerStorage: NewInMemoryLedgerStorage(), failAccount: WalletAccount("p1")})
+	if err := rideMgr.SetLedger(ledger, 0); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	for _, passengerID := range []string{"p1", "p2"} {
+		if _, err := ledger.TopUp(passengerID, 300_00); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+	}
+	departure := rideMgr.now().Add(5 * time.Hour)
+	ride := Ride{ID: "4", DriverID: "1", VehicleID: "1", Source: "C", Destination: "D", AvailableSeats: 4, Pricing: SplitCost, TripCost: 300, DepartureTime: departure, ArrivalTime: departure.Add(time.Hour)}
+	if err := rideMgr.OfferRide(ride); err != nil {
+		t.Fatalf("Error offering ride: %v", err)
+	}
+	first, err := rideMgr.SelectRide("p1", "C", "D", 1, "")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if _, err := rideMgr.SelectRide("p2", "C", "D", 2, ""); err == nil {
+		t.Fatalf("Expected an error when p1's share can't be refunded, but got nil")
+	}
+
+	if kept, _ := rideMgr.GetBookingByID(first.ID); kept.Share() != 150 {
+		t.Fatalf("Expected p1 to keep a share of 150.00, but got %.2f", kept.Share())
+	}
+	if ledger.Balance("p1") != 150_00 || ledger.Balance("p2") != 300_00 {
+		t.Fatalf("Expected p1 to have paid 150.00 and p2 nothing, but got %v and %v", ledger.Balance("p1"), ledger.Balance("p2"))
+	}
+	if stored, _ := rideMgr.storage.GetRideByID("4"); stored.AvailableSeats != 3 {
+		t.Fatalf("Expected p2's seats to be returned, but %d are free", stored.AvailableSeats)
+	}
+	if err := ledger.CheckBalanced(); err != nil {
+		t.Fatalf("Expected the ledger to balance, but got %v", err)
+	}
+}
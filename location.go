@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// earthRadius is the mean radius of the Earth in metres.
+const earthRadius = 6371000
+
+// Location is a named point. Rides start and end at places registered with a
+// placeManager, keyed by name.
+type Location struct {
+	Name string
+	Lat  float64
+	Lon  float64
+}
+
+// DistanceTo returns the great-circle distance to other in metres.
+func (l Location) DistanceTo(other Location) float64 {
+	lat1, lat2 := l.Lat*math.Pi/180, other.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (other.Lon - l.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+type placeManager struct {
+	storage PlaceStorage
+}
+
+func NewPlaceManager(storage PlaceStorage) *placeManager {
+	return &placeManager{storage: storage}
+}
+
+func (pm *placeManager) AddPlace(place Location) error {
+	if place.Name == "" {
+		return fmt.Errorf("place name is required")
+	}
+	if place.Lat < -90 || place.Lat > 90 || place.Lon < -180 || place.Lon > 180 {
+		return fmt.Errorf("place %s has invalid coordinates %v,%v", place.Name, place.Lat, place.Lon)
+	}
+	if err := pm.storage.AddPlace(place); err != nil {
+		return fmt.Errorf("could not add place: %v", err)
+	}
+	fmt.Printf("Place added: %+v\n", place)
+	return nil
+}
+
+func (pm *placeManager) GetPlace(name string) (Location, error) {
+	place, err := pm.storage.GetPlaceByName(name)
+	if err != nil {
+		return Location{}, fmt.Errorf("could not find place %s: %v", name, err)
+	}
+	return place, nil
+}
+
+// Nearby returns the places within radius metres of loc, nearest first.
+func (pm *placeManager) Nearby(loc Location, radius float64) []Location {
+	var places []Location
+	for _, place := range pm.storage.GetAllPlaces() {
+		if loc.DistanceTo(place) <= radius {
+			places = append(places, place)
+		}
+	}
+	sort.Slice(places, func(i, j int) bool {
+		di, dj := loc.DistanceTo(places[i]), loc.DistanceTo(places[j])
+		if di != dj {
+			return di < dj
+		}
+		return places[i].Name < places[j].Name
+	})
+	return places
+}
+
+// SetPlaces lets searches match rides whose endpoints are registered places
+// within walkingRadius metres of the passenger's. Places that are not
+// registered, or a zero radius, match by name only.
+func (rm *rideManager) SetPlaces(places *placeManager, walkingRadius float64) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.places = places
+	rm.walkingRadius = walkingRadius
+}
+
+// locate returns the coordinates of a registered place.
+func (rm *rideManager) locate(place string) (Location, bool) {
+	rm.mu.Lock()
+	places := rm.places
+	rm.mu.Unlock()
+	if places == nil {
+		return Location{}, false
+	}
+	loc, err := places.storage.GetPlaceByName(place)
+	return loc, err == nil
+}
+
+// walkable returns the names of the places a passenger at place can walk to.
+// The place itself is always included.
+func (rm *rideManager) walkable(place string) map[string]bool {
+	if loc, ok := rm.locate(place); ok {
+		return rm.walkableFrom(loc)
+	}
+	return map[string]bool{place: true}
+}
+
+// walkableFrom returns the names of the registered places within walking
+// distance of loc, plus loc's own name.
+func (rm *rideManager) walkableFrom(loc Location) map[string]bool {
+	rm.mu.Lock()
+	places, radius := rm.places, rm.walkingRadius
+	rm.mu.Unlock()
+	names := map[string]bool{loc.Name: true}
+	if places == nil || radius <= 0 {
+		return names
+	}
+	for _, place := range places.Nearby(loc, radius) {
+		names[place.Name] = true
+	}
+	return names
+}
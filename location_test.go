@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// newPlacesFixture registers Home and Office with a stop about 300m from
+// each, and offers rides between the stops plus a two-leg route to Mall.
+func newPlacesFixture(t *testing.T) (*rideManager, *placeManager) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	placeMgr := NewPlaceManager(NewInMemoryPlaceStorage())
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	rideMgr.now = func() time.Time { return now }
+
+	for _, place := range []Location{
+		{Name: "Home", Lat: 12.9716, Lon: 77.5946},
+		{Name: "HomeStop", Lat: 12.9743, Lon: 77.5946},
+		{Name: "Office", Lat: 12.9352, Lon: 77.6245},
+		{Name: "OfficeGate", Lat: 12.9352, Lon: 77.6275},
+		{Name: "Airport", Lat: 13.1986, Lon: 77.7066},
+		{Name: "Mall", Lat: 12.9279, Lon: 77.6271},
+	} {
+		if err := placeMgr.AddPlace(place); err != nil {
+			t.Fatalf("Error adding place: %v", err)
+		}
+	}
+	rideMgr.SetPlaces(placeMgr, 0)
+	rides := []Ride{
+		{ID: "R1", Source: "HomeStop", Destination: "OfficeGate"},
+		{ID: "R2", Source: "Airport", Destination: "Office"},
+		{ID: "R3", Source: "HomeStop", Destination: "Airport"},
+		{ID: "R4", Source: "Airport", Destination: "Mall"},
+	}
+	for _, ride := range rides {
+		_ = userMgr.AddUser(User{ID: ride.ID, Name: "Driver" + ride.ID, Role: Driver})
+		_ = vehicleMgr.AddVehicle(Vehicle{ID: ride.ID, OwnerID: ride.ID, Model: "XUV", Capacity: 7})
+		ride.DriverID, ride.VehicleID, ride.AvailableSeats = ride.ID, ride.ID, 4
+		if err := rideMgr.OfferRide(ride); err != nil {
+			t.Fatalf("Error offering ride: %v", err)
+		}
+	}
+	return rideMgr, placeMgr
+}
+
+// Test great-circle distances between places
+func TestLocationDistanceTo(t *testing.T) {
+	home := Location{Name: "Home", Lat: 12.9716, Lon: 77.5946}
+	tests := []struct {
+		other    Location
+		expected float64
+	}{
+		{other: home, expected: 0},
+		{other: Location{Lat: 12.9743, Lon: 77.5946}, expected: 300},
+		{other: Location{Lat: 13.1986, Lon: 77.7066}, expected: 27950},
+	}
+	for _, tt := range tests {
+		if got := home.DistanceTo(tt.other); math.Abs(got-tt.expected) > tt.expected*0.01+1 {
+			t.Fatalf("Expected about %v metres to %+v, but got %v", tt.expected, tt.other, got)
+		}
+	}
+}
+
+// Test adding places and finding those nearby
+func TestPlaceManager(t *testing.T) {
+	_, placeMgr := newPlacesFixture(t)
+
+	for _, place := range []Location{{Lat: 1, Lon: 1}, {Name: "North", Lat: 91}, {Name: "East", Lon: 181}, {Name: "Home"}} {
+		if err := placeMgr.AddPlace(place); err == nil {
+			t.Fatalf("Expected error adding %+v, but got none", place)
+		}
+	}
+
+	home, err := placeMgr.GetPlace("Home")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	var names []string
+	for _, place := range placeMgr.Nearby(home, 500) {
+		names = append(names, place.Name)
+	}
+	if fmt.Sprint(names) != "[Home HomeStop]" {
+		t.Fatalf("Expected [Home HomeStop], but got %v", names)
+	}
+}
+
+// Test that searches match rides within walking distance of both ends
+func TestWalkingRadius(t *testing.T) {
+	rideMgr, placeMgr := newPlacesFixture(t)
+
+	if rides := rideMgr.GetDirectRides("Home", "Office", TimeWindow{}); len(rides) != 0 {
+		t.Fatalf("Expected exact matching without a walking radius, but got %+v", rides)
+	}
+
+	rideMgr.SetPlaces(placeMgr, 500)
+	rides := rideMgr.GetDirectRides("Home", "Office", TimeWindow{})
+	if len(rides) != 1 || rides[0].ID != "R1" {
+		t.Fatalf("Expected ride R1, but got %+v", rides)
+	}
+	if rides := rideMgr.GetRidesBySource("Home"); len(rides) != 2 {
+		t.Fatalf("Expected 2 rides from near Home, but got %+v", rides)
+	}
+	rides = rideMgr.GetDirectRidesNear(Location{Name: "pin", Lat: 12.9730, Lon: 77.5950}, Location{Name: "pin", Lat: 12.9352, Lon: 77.6260}, TimeWindow{})
+	if len(rides) != 1 || rides[0].ID != "R1" {
+		t.Fatalf("Expected ride R1 near the given coordinates, but got %+v", rides)
+	}
+
+	legs, err := rideMgr.FindRoute("Home", "Mall", 1, RouteOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if got := fmt.Sprint(routeIDs(legs)); got != "[R3 R4]" {
+		t.Fatalf("Expected route [R3 R4], but got %s", got)
+	}
+
+	rideMgr.SetPlaces(placeMgr, 100)
+	if rides := rideMgr.GetDirectRides("Home", "Office", TimeWindow{}); len(rides) != 0 {
+		t.Fatalf("Expected no rides within 100m, but got %+v", rides)
+	}
+}
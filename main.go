@@ -1,67 +1,187 @@
 package main
 
-import "fmt"
+import (
+	"flag"
+	"fmt"
+	"io"
+	"time"
+)
+
+// walkingRadius is how far, in metres, a passenger will walk to a pickup.
+const walkingRadius = 500
 
 func main() {
+	dataDir := flag.String("data-dir", "", "directory for durable storage (in-memory if empty)")
+	flag.Parse()
+
 	// Creating storage
-	userStorage := NewInMemoryUserStorage()
-	vehicleStorage := NewInMemoryVehicleStorage()
-	rideStorage := NewInMemoryRideStorage()
+	userStorage, vehicleStorage, placeStorage, rideStorage, bookingStorage, ledgerStorage, err := newStorage(*dataDir)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer closeStores(userStorage, vehicleStorage, placeStorage, rideStorage, bookingStorage, ledgerStorage)
 
 	// Creating managers
 	userMgr := NewUserManager(userStorage)
 	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
-	rideMgr := NewRideManager(rideStorage, userMgr, vehicleMgr)
-
-	// Adding users
-	if err := userMgr.AddUser(User{ID: "1", Name: "Amar", Role: "Driver"}); err != nil {
+	placeMgr := NewPlaceManager(placeStorage)
+	rideMgr := NewRideManager(rideStorage, bookingStorage, userMgr, vehicleMgr)
+	ledgerMgr := NewLedgerManager(ledgerStorage)
+	rideMgr.SetPlaces(placeMgr, walkingRadius)
+	rideMgr.SetFareSchedule(FareSchedule{
+		BaseFare:            30,
+		PerKm:               12,
+		PerMinute:           1.5,
+		MinimumFare:         50,
+		CategoryMultipliers: map[VehicleCategory]float64{Hatchback: 0.9, SUV: 1.3, Van: 1.5},
+	})
+	if err := rideMgr.SetSurgePolicy(SurgePolicy{Window: time.Hour, Curve: LinearSurge(1, 0.5), Max: 2}); err != nil {
 		fmt.Println(err)
 		return
 	}
-	if err := userMgr.AddUser(User{ID: "2", Name: "Chetan", Role: "Driver"}); err != nil {
+	if err := rideMgr.SetLedger(ledgerMgr, 0.1); err != nil {
 		fmt.Println(err)
 		return
 	}
-	if err := userMgr.AddUser(User{ID: "3", Name: "Bhuwan", Role: "Passenger"}); err != nil {
+	if err := rideMgr.SetCancellationPolicy(CancellationPolicy{FreeWindow: 5 * time.Minute, FreeBefore: time.Hour, LateFee: 0.2, NoShowFee: 0.5}); err != nil {
 		fmt.Println(err)
 		return
 	}
+
+	// A durable run seeds the demo data once and shows what it has from then on.
+	if len(userStorage.GetAllUsers()) == 0 {
+		if err := runDemo(userMgr, vehicleMgr, placeMgr, rideMgr, ledgerMgr); err != nil {
+			fmt.Println(err)
+			return
+		}
+	} else {
+		fmt.Printf("Loaded existing data from %s\n", *dataDir)
+	}
+	rideMgr.PrintRideStats()
+	ledgerMgr.PrintWalletBalances()
+}
+
+// runDemo seeds users, vehicles, places and rides, then books and finishes a
+// few rides.
+func runDemo(userMgr *userManager, vehicleMgr *vehicleManager, placeMgr *placeManager, rideMgr *rideManager, ledgerMgr *ledgerManager) error {
+	// Adding users
+	if err := userMgr.AddUser(User{ID: "1", Name: "Amar", Role: "Driver"}); err != nil {
+		return err
+	}
+	if err := userMgr.AddUser(User{ID: "2", Name: "Chetan", Role: "Driver"}); err != nil {
+		return err
+	}
+	if err := userMgr.AddUser(User{ID: "3", Name: "Bhuwan", Role: "Passenger"}); err != nil {
+		return err
+	}
 	if err := userMgr.AddUser(User{ID: "4", Name: "Vijay", Role: "Passenger"}); err != nil {
-		fmt.Println(err)
-		return
+		return err
+	}
+
+	// Funding passenger wallets
+	for _, userID := range []string{"3", "4"} {
+		if _, err := ledgerMgr.TopUp(userID, 2000_00); err != nil {
+			return err
+		}
 	}
 
 	// Adding vehicles
-	if err := vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4}); err != nil {
-		fmt.Println(err)
-		return
+	if err := vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Category: Sedan, Capacity: 4}); err != nil {
+		return err
 	}
 
-	if err := vehicleMgr.AddVehicle(Vehicle{ID: "2", OwnerID: "2", Model: "XUV", Capacity: 7}); err != nil {
-		fmt.Println(err)
-		return
+	if err := vehicleMgr.AddVehicle(Vehicle{ID: "2", OwnerID: "2", Model: "XUV", Category: SUV, Capacity: 7}); err != nil {
+		return err
+	}
+
+	// Adding places
+	for _, place := range []Location{
+		{Name: "A", Lat: 12.9716, Lon: 77.5946},
+		{Name: "B", Lat: 12.9352, Lon: 77.6245},
+		{Name: "C", Lat: 12.9698, Lon: 77.7500},
+	} {
+		if err := placeMgr.AddPlace(place); err != nil {
+			return err
+		}
 	}
 
 	// Offering rides
 	if err := rideMgr.OfferRide(Ride{ID: "101", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4}); err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
 	if err := rideMgr.OfferRide(Ride{ID: "102", DriverID: "2", VehicleID: "2", Source: "B", Destination: "C", AvailableSeats: 4}); err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
 
 	_, err := rideMgr.SelectRide("3", "A", "C", 3, string(MostVacantSeats))
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
 
 	_, err = rideMgr.SelectRide("4", "A", "B", 1, string(MostVacantSeats))
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
+	}
+
+	// Travelling and finishing rides pays the drivers
+	for _, rideID := range []string{"101", "102"} {
+		if err := rideMgr.StartRide(rideID); err != nil {
+			return err
+		}
+		if err := rideMgr.EndRide(rideID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newStorage returns file-backed stores rooted at dataDir, or in-memory stores
+// when dataDir is empty.
+func newStorage(dataDir string) (UserStorage, VehicleStorage, PlaceStorage, RideStorage, BookingStorage, LedgerStorage, error) {
+	if dataDir == "" {
+		return NewInMemoryUserStorage(), NewInMemoryVehicleStorage(), NewInMemoryPlaceStorage(), NewInMemoryRideStorage(), NewInMemoryBookingStorage(), NewInMemoryLedgerStorage(), nil
+	}
+	userStorage, err := NewFileUserStorage(dataDir)
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, fmt.Errorf("could not open user storage: %v", err)
+	}
+	vehicleStorage, err := NewFileVehicleStorage(dataDir)
+	if err != nil {
+		closeStores(userStorage)
+		return nil, nil, nil, nil, nil, nil, fmt.Errorf("could not open vehicle storage: %v", err)
+	}
+	placeStorage, err := NewFilePlaceStorage(dataDir)
+	if err != nil {
+		closeStores(userStorage, vehicleStorage)
+		return nil, nil, nil, nil, nil, nil, fmt.Errorf("could not open place storage: %v", err)
+	}
+	rideStorage, err := NewFileRideStorage(dataDir)
+	if err != nil {
+		closeStores(userStorage, vehicleStorage, placeStorage)
+		return nil, nil, nil, nil, nil, nil, fmt.Errorf("could not open ride storage: %v", err)
+	}
+	bookingStorage, err := NewFileBookingStorage(dataDir)
+	if err != nil {
+		closeStores(userStorage, vehicleStorage, placeStorage, rideStorage)
+		return nil, nil, nil, nil, nil, nil, fmt.Errorf("could not open booking storage: %v", err)
+	}
+	ledgerStorage, err := NewFileLedgerStorage(dataDir)
+	if err != nil {
+		closeStores(userStorage, vehicleStorage, placeStorage, rideStorage, bookingStorage)
+		return nil, nil, nil, nil, nil, nil, fmt.Errorf("could not open ledger storage: %v", err)
+	}
+	return userStorage, vehicleStorage, placeStorage, rideStorage, bookingStorage, ledgerStorage, nil
+}
+
+// closeStores closes the stores that hold files open; in-memory stores have
+// nothing to close.
+func closeStores(stores ...any) {
+	for _, store := range stores {
+		if closer, ok := store.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				fmt.Println(err)
+			}
+		}
 	}
-	rideMgr.PrintRideStats()
 }
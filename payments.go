@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// SetLedger charges passengers' wallets when they book and pays drivers when
+// their rides complete, keeping platformFee, a fraction of each payment, for
+// the platform. Until a ledger is set no money moves.
+func (rm *rideManager) SetLedger(ledger *ledgerManager, platformFee float64) error {
+	if platformFee < 0 || platformFee > 1 || math.IsNaN(platformFee) {
+		return fmt.Errorf("platform fee must be between 0 and 1, got %v", platformFee)
+	}
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.ledger, rm.platformFee = ledger, platformFee
+	return nil
+}
+
+func (rm *rideManager) currentLedger() (*ledgerManager, float64) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	return rm.ledger, rm.platformFee
+}
+
+// legAmount returns what the booking pays for all its seats on the i-th leg.
+func (b Booking) legAmount(i int) Money {
+	if i >= len(b.LegFares) {
+		return 0
+	}
+	return toMoney(b.LegFares[i] * float64(b.Seats))
+}
+
+// amount returns what the booking pays in total, leg by leg as it is paid out.
+func (b Booking) amount() Money {
+	var amount Money
+	for i := range b.LegFares {
+		amount += b.legAmount(i)
+	}
+	return amount
+}
+
+// transfer posts a transaction of kind moving amount from one account to
+// another. Nothing is posted without a ledger or for a zero amount.
+func (rm *rideManager) transfer(kind TransactionKind, reference, memo string, from, to AccountID, amount Money) error {
+	ledger, _ := rm.currentLedger()
+	if ledger == nil || amount == 0 {
+		return nil
+	}
+	_, err := ledger.Post(Transaction{
+		Kind:      kind,
+		Reference: reference,
+		Memo:      memo,
+		Postings:  []Posting{{Account: from, Amount: -amount}, {Account: to, Amount: amount}},
+		CreatedAt: rm.now(),
+	})
+	return err
+}
+
+// chargeBooking moves what a booking costs from the passenger's wallet into
+// escrow until its rides complete. The booking is refused if the wallet can't
+// cover it.
+func (rm *rideManager) chargeBooking(booking Booking) error {
+	ledger, _ := rm.currentLedger()
+	amount := booking.amount()
+	if ledger == nil || amount == 0 {
+		return nil
+	}
+	_, err := ledger.Charge(booking.PassengerID, Transaction{
+		Kind:      BookingCharge,
+		Reference: booking.ID,
+		Memo:      fmt.Sprintf("%d seat(s) on %v", booking.Seats, booking.RideIDs()),
+		Postings:  []Posting{{Account: WalletAccount(booking.PassengerID), Amount: -amount}, {Account: EscrowAccount, Amount: amount}},
+		CreatedAt: rm.now(),
+	})
+	return err
+}
+
+// adjustCharge charges or refunds the difference after a booking's price
+// changed from paid.
+func (rm *rideManager) adjustCharge(booking Booking, paid Money) error {
+	diff := booking.amount() - paid
+	if diff > 0 {
+		return rm.transfer(BookingCharge, booking.ID, "cost share increased", WalletAccount(booking.PassengerID), EscrowAccount, diff)
+	}
+	return rm.refundBooking(booking, -diff, "cost share decreased")
+}
+
+// refundBooking returns amount of a booking's payment from escrow to the
+// passenger.
+func (rm *rideManager) refundBooking(booking Booking, amount Money, memo string) error {
+	return rm.transfer(Refund, booking.ID, memo, EscrowAccount, WalletAccount(booking.PassengerID), amount)
+}
+
+// settleRide pays the driver of a completed ride what each confirmed booking
+// paid for it, less the platform fee.
+func (rm *rideManager) settleRide(rideID string) error {
+	ledger, platformFee := rm.currentLedger()
+	if ledger == nil {
+		return nil
+	}
+	ride, err := rm.storage.GetRideByID(rideID)
+	if err != nil {
+		return fmt.Errorf("could not find ride %s: %v", rideID, err)
+	}
+	rm.bookingMu.Lock()
+	defer rm.bookingMu.Unlock()
+	for _, booking := range rm.GetBookingsByRide(rideID) {
+		if booking.Status != BookingConfirmed {
+			continue
+		}
+		var paid Money
+		for i, leg := range booking.Legs {
+			if leg.ID == rideID {
+				paid += booking.legAmount(i)
+			}
+		}
+		if err := rm.payDriver(booking, ride.DriverID, paid, platformFee, fmt.Sprintf("ride %s", rideID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// payDriver moves amount of a booking's payment from escrow to a driver, less
+// the platform fee.
+func (rm *rideManager) payDriver(booking Booking, driverID string, amount Money, platformFee float64, memo string) error {
+	fee := Money(math.Round(float64(amount) * platformFee))
+	if err := rm.transfer(DriverEarnings, booking.ID, memo, EscrowAccount, WalletAccount(driverID), amount-fee); err != nil {
+		return fmt.Errorf("could not pay driver %s for booking %s: %v", driverID, booking.ID, err)
+	}
+	if err := rm.transfer(PlatformFee, booking.ID, memo, EscrowAccount, PlatformFeesAccount, fee); err != nil {
+		return fmt.Errorf("could not collect platform fee for booking %s: %v", booking.ID, err)
+	}
+	return nil
+}
+
+// unsettled returns what a booking paid for each leg that is still held in
+// escrow, i.e. whose ride has not completed.
+func (rm *rideManager) unsettled(booking Booking) []Money {
+	owed := make([]Money, len(booking.Legs))
+	for i, leg := range booking.Legs {
+		if ride, err := rm.storage.GetRideByID(leg.ID); err == nil && ride.Status == RideCompleted {
+			continue
+		}
+		owed[i] = booking.legAmount(i)
+	}
+	return owed
+}
+
+// forfeit settles a booking that won't be travelled, given what it still owes
+// each leg: fee goes to the drivers of the legs in proportion to what each
+// leg cost, and the rest is refunded.
+func (rm *rideManager) forfeit(booking Booking, owed []Money, fee Money) error {
+	ledger, platformFee := rm.currentLedger()
+	var amount Money
+	for _, legAmount := range owed {
+		amount += legAmount
+	}
+	if ledger == nil || amount == 0 {
+		return nil
+	}
+	remaining := fee
+	for i, leg := range booking.Legs {
+		legFee := Money(math.Round(float64(fee) * float64(owed[i]) / float64(amount)))
+		if i == len(booking.Legs)-1 {
+			legFee = remaining
+		}
+		remaining -= legFee
+		if err := rm.payDriver(booking, leg.DriverID, legFee, platformFee, fmt.Sprintf("cancellation fee, ride %s", leg.ID)); err != nil {
+			return err
+		}
+	}
+	return rm.refundBooking(booking, amount-fee, booking.CancellationReason)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SelectionPreferences says which rides a passenger will accept and how to
+// choose among them.
+type SelectionPreferences struct {
+	Vehicle  VehiclePreference
+	MinSeats int    // free seats a ride must have before booking; zero means just the seats booked
+	Sort     string // strategy preference resolved by the registry; empty means Most Vacant
+}
+
+// sortAliases are the short names accepted by "sort=" in a preference query.
+var sortAliases = map[string]Strategy{
+	"vacant":   MostVacantSeats,
+	"earliest": EarliestDeparture,
+	"fare":     CheapestRide,
+	"cheapest": CheapestRide,
+}
+
+// ParsePreferences parses a query such as "vehicle=XUV;minSeats=2;sort=vacant".
+// Clauses are "key=value" pairs separated by ";" and each key may appear once.
+// vehicle names a model or model family; category, minCapacity and
+// maxCapacity further restrict the vehicle, and degrade=true allows the
+// next-best vehicle when none match. sort takes one of the aliases vacant,
+// earliest, fare or cheapest, or the name of a registered strategy.
+func ParsePreferences(query string) (SelectionPreferences, error) {
+	var prefs SelectionPreferences
+	seen := make(map[string]bool)
+	for _, clause := range strings.Split(query, ";") {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(clause, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok {
+			return SelectionPreferences{}, fmt.Errorf("invalid preference %q: expected key=value", clause)
+		}
+		if value == "" {
+			return SelectionPreferences{}, fmt.Errorf("invalid preference %q: missing value", clause)
+		}
+		if seen[key] {
+			return SelectionPreferences{}, fmt.Errorf("invalid preference %q: %s given more than once", clause, key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "vehicle":
+			prefs.Vehicle.Model = value
+		case "category":
+			category, err := parseVehicleCategory(value)
+			if err != nil {
+				return SelectionPreferences{}, fmt.Errorf("invalid preference %q: %v", clause, err)
+			}
+			prefs.Vehicle.Category = category
+		case "minSeats", "minCapacity", "maxCapacity":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return SelectionPreferences{}, fmt.Errorf("invalid preference %q: %s must be a positive number", clause, key)
+			}
+			switch key {
+			case "minSeats":
+				prefs.MinSeats = n
+			case "minCapacity":
+				prefs.Vehicle.MinCapacity = n
+			case "maxCapacity":
+				prefs.Vehicle.MaxCapacity = n
+			}
+		case "degrade":
+			degrade, err := strconv.ParseBool(value)
+			if err != nil {
+				return SelectionPreferences{}, fmt.Errorf("invalid preference %q: degrade must be true or false", clause)
+			}
+			prefs.Vehicle.Degrade = degrade
+		case "sort":
+			if alias, ok := sortAliases[value]; ok {
+				value = string(alias)
+			}
+			prefs.Sort = value
+		default:
+			return SelectionPreferences{}, fmt.Errorf("invalid preference %q: unknown key %q", clause, key)
+		}
+	}
+	if v := prefs.Vehicle; v.MaxCapacity != 0 && v.MaxCapacity < v.MinCapacity {
+		return SelectionPreferences{}, fmt.Errorf("invalid preferences: maxCapacity %d is below minCapacity %d", v.MaxCapacity, v.MinCapacity)
+	}
+	return prefs, nil
+}
+
+// parsePreference reads the preference SelectRide is given: either a query
+// for ParsePreferences or, as before, a strategy preference such as
+// "Preferred Vehicle=Toyota|Most Vacant".
+func parsePreference(preference string) (SelectionPreferences, error) {
+	key, _, _ := strings.Cut(preference, "=")
+	switch strings.TrimSpace(key) {
+	case "vehicle", "category", "minCapacity", "maxCapacity", "degrade", "minSeats", "sort":
+		return ParsePreferences(preference)
+	}
+	if strings.Contains(preference, ";") || strings.TrimSpace(preference) == "" {
+		return ParsePreferences(preference)
+	}
+	return SelectionPreferences{Sort: preference}, nil
+}
+
+// minSeats is the number of free seats a ride needs to be a candidate.
+func (p SelectionPreferences) minSeats(seats int) int {
+	return max(seats, p.MinSeats)
+}
+
+// strategy returns the strategy preference to resolve, defaulting to Most
+// Vacant.
+func (p SelectionPreferences) strategy() string {
+	if p.Sort == "" {
+		return string(MostVacantSeats)
+	}
+	return p.Sort
+}
+
+// vehicle is the vehicle preference applied to every leg. When no model is
+// given and the strategy preference starts with "Preferred Vehicle=<model>",
+// that model is used instead, degrading if the preference has fallbacks.
+func (p SelectionPreferences) vehicle() VehiclePreference {
+	vehicle := p.Vehicle
+	first, _, chained := strings.Cut(p.strategy(), "|")
+	if name, model, _ := strings.Cut(strings.TrimSpace(first), "="); vehicle.Model == "" && name == string(PreferredVehicle) {
+		vehicle.Model = model
+		vehicle.Degrade = vehicle.Degrade || chained
+	}
+	return vehicle
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+)
+
+// Test parsing preference queries
+func TestParsePreferences(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected SelectionPreferences
+	}{
+		{query: "", expected: SelectionPreferences{}},
+		{query: "vehicle=XUV;minSeats=2;sort=vacant", expected: SelectionPreferences{Vehicle: VehiclePreference{Model: "XUV"}, MinSeats: 2, Sort: string(MostVacantSeats)}},
+		{query: " sort = earliest ; ", expected: SelectionPreferences{Sort: string(EarliestDeparture)}},
+		{query: "sort=Lowest Fare", expected: SelectionPreferences{Sort: string(CheapestRide)}},
+	}
+	for _, tt := range tests {
+		prefs, err := ParsePreferences(tt.query)
+		if err != nil {
+			t.Fatalf("%q: expected no error, but got %v", tt.query, err)
+		}
+		if prefs != tt.expected {
+			t.Fatalf("%q: expected %+v, but got %+v", tt.query, tt.expected, prefs)
+		}
+	}
+
+	for _, query := range []string{"vehicle", "vehicle=", "minSeats=two", "minSeats=0", "colour=red", "vehicle=XUV;vehicle=Swift"} {
+		if _, err := ParsePreferences(query); err == nil {
+			t.Fatalf("%q: expected error, but got none", query)
+		}
+	}
+}
+
+// Test that Quote and SelectRide accept preference queries alongside strategy names
+func TestSelectRideWithPreferenceQuery(t *testing.T) {
+	rideMgr := newStrategyFixture(t)
+
+	tests := []struct {
+		preference string
+		expected   string
+	}{
+		{preference: "vehicle=Swift", expected: "3"},
+		{preference: "minSeats=3;sort=earliest", expected: "3"},
+		{preference: "minSeats=5;sort=earliest", expected: "2"},
+		{preference: "sort=Preferred Vehicle=Toyota", expected: "1"},
+		{preference: "Preferred Vehicle=Toyota", expected: "1"},
+	}
+	for _, tt := range tests {
+		it, err := rideMgr.Quote("A", "B", 1, tt.preference, TimeWindow{})
+		if err != nil {
+			t.Fatalf("%s: expected no error, but got %v", tt.preference, err)
+		}
+		if got := it.Legs[0].Ride.ID; got != tt.expected {
+			t.Fatalf("%s: expected ride %s, but got %s", tt.preference, tt.expected, got)
+		}
+	}
+
+	for _, preference := range []string{"vehicle=Tesla", "minSeats=7", "sort=fastest", "vehicle=XUV;minSeats"} {
+		if _, err := rideMgr.SelectRide("p1", "A", "B", 1, preference); err == nil {
+			t.Fatalf("%s: expected error, but got none", preference)
+		}
+	}
+}
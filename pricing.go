@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// FareSchedule prices one seat on one leg from the distance and time it
+// travels and the category of the vehicle.
+type FareSchedule struct {
+	BaseFare            float64 // charged on every leg
+	PerKm               float64
+	PerMinute           float64
+	MinimumFare         float64
+	CategoryMultipliers map[VehicleCategory]float64 // categories not listed are charged 1x
+}
+
+// Fare returns the per-seat fare for a leg of distance km lasting duration in
+// a vehicle of category, rounded to two decimals.
+func (s FareSchedule) Fare(distance float64, duration time.Duration, category VehicleCategory) float64 {
+	fare := s.BaseFare + s.PerKm*distance + s.PerMinute*duration.Minutes()
+	fare = math.Max(fare, s.MinimumFare)
+	if multiplier, ok := s.CategoryMultipliers[category]; ok {
+		fare *= multiplier
+	}
+	return roundFare(fare)
+}
+
+func roundFare(fare float64) float64 {
+	return math.Round(fare*100) / 100
+}
+
+// SetFareSchedule prices every leg with schedule, replacing any function set
+// with SetFareFunc. Legs through places without coordinates are priced on
+// time alone.
+func (rm *rideManager) SetFareSchedule(schedule FareSchedule) {
+	multipliers := make(map[VehicleCategory]float64, len(schedule.CategoryMultipliers))
+	for category, multiplier := range schedule.CategoryMultipliers {
+		multipliers[category] = multiplier
+	}
+	schedule.CategoryMultipliers = multipliers
+
+	rm.SetFareFunc(func(ride Ride) float64 {
+		var category VehicleCategory
+		if vehicle, err := rm.vehicleMgr.GetVehicleByID(ride.VehicleID); err == nil {
+			category = vehicle.Category
+		}
+		distance, _ := rm.legDistance(ride)
+		var duration time.Duration
+		if ride.IsScheduled() {
+			duration = ride.ArrivalTime.Sub(ride.DepartureTime)
+		}
+		return schedule.Fare(distance, duration, category)
+	})
+}
+
+// legDistance returns the kilometres a leg covers through its stops, or false
+// if a place on it has no coordinates.
+func (rm *rideManager) legDistance(ride Ride) (float64, bool) {
+	var distance float64
+	var prev Location
+	for i, place := range ride.Route() {
+		loc, ok := rm.locate(place)
+		if !ok {
+			return 0, false
+		}
+		if i > 0 {
+			distance += prev.DistanceTo(loc) / 1000
+		}
+		prev = loc
+	}
+	return distance, true
+}
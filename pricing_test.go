@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test the fare for one seat on one leg
+func TestFareScheduleFare(t *testing.T) {
+	schedule := FareSchedule{BaseFare: 20, PerKm: 10, PerMinute: 1.5, MinimumFare: 50, CategoryMultipliers: map[VehicleCategory]float64{SUV: 1.2}}
+	tests := []struct {
+		distance float64
+		duration time.Duration
+		category VehicleCategory
+		expected float64
+	}{
+		{distance: 10, duration: 20 * time.Minute, category: Sedan, expected: 150},
+		{distance: 10, duration: 20 * time.Minute, category: SUV, expected: 180},
+		{distance: 1, duration: 0, category: Sedan, expected: 50},
+		{distance: 1, duration: 0, category: SUV, expected: 60},
+		{distance: 3.333, duration: 0, category: Sedan, expected: 53.33},
+	}
+	for _, tt := range tests {
+		if got := schedule.Fare(tt.distance, tt.duration, tt.category); got != tt.expected {
+			t.Fatalf("%vkm, %v, %s: expected %v, but got %v", tt.distance, tt.duration, tt.category, tt.expected, got)
+		}
+	}
+}
+
+// Test that direct and multi-leg search results are priced by distance
+func TestSearchResultsArePriced(t *testing.T) {
+	rideMgr, placeMgr := newPlacesFixture(t)
+	rideMgr.SetFareSchedule(FareSchedule{BaseFare: 20, PerKm: 10, MinimumFare: 50})
+
+	km := func(from, to string) float64 {
+		a, _ := placeMgr.GetPlace(from)
+		b, _ := placeMgr.GetPlace(to)
+		return a.DistanceTo(b) / 1000
+	}
+
+	direct, err := rideMgr.Quote("HomeStop", "OfficeGate", 2, string(MostVacantSeats), TimeWindow{})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	leg := direct.Legs[0]
+	if expected := roundFare(20 + 10*km("HomeStop", "OfficeGate")); leg.Fare != expected || direct.Price != 2*expected {
+		t.Fatalf("Expected %v per seat and %v in total, but got %v and %v", expected, 2*expected, leg.Fare, direct.Price)
+	}
+	if leg.Distance != km("HomeStop", "OfficeGate") {
+		t.Fatalf("Expected the leg distance to be reported, but got %v", leg.Distance)
+	}
+
+	itineraries, err := rideMgr.SearchItineraries("HomeStop", "Mall", 1, 1, RouteOptions{})
+	if err != nil || len(itineraries) != 1 {
+		t.Fatalf("Expected 1 itinerary, but got %d (%v)", len(itineraries), err)
+	}
+	it := itineraries[0]
+	expected := roundFare(20+10*km("HomeStop", "Airport")) + roundFare(20+10*km("Airport", "Mall"))
+	if len(it.Legs) != 2 || it.Price != roundFare(expected) {
+		t.Fatalf("Expected two legs costing %v, but got %d costing %v", expected, len(it.Legs), it.Price)
+	}
+}
+
+// Test that vehicle categories change fares and the Lowest Fare strategy follows
+func TestCategoryMultipliers(t *testing.T) {
+	rideMgr := newVehicleFixture(t)
+	multipliers := map[VehicleCategory]float64{Van: 1.5, Hatchback: 0.8}
+	rideMgr.SetFareSchedule(FareSchedule{BaseFare: 100, CategoryMultipliers: multipliers})
+	multipliers[Hatchback] = 3 // the schedule keeps its own copy
+
+	expected := map[string]float64{"XY1": 150, "XY2": 100, "XY3": 80}
+	for _, preference := range []string{"vehicle=Toyota Innova", "vehicle=Toyota Etios", "vehicle=Maruti"} {
+		it, err := rideMgr.Quote("X", "Y", 1, preference, TimeWindow{})
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if leg := it.Legs[0]; leg.Fare != expected[leg.Ride.ID] {
+			t.Fatalf("Expected ride %s to cost %v, but got %v", leg.Ride.ID, expected[leg.Ride.ID], leg.Fare)
+		}
+	}
+
+	it, err := rideMgr.Quote("X", "Y", 1, "sort=fare", TimeWindow{})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if it.Legs[0].Ride.ID != "XY3" {
+		t.Fatalf("Expected the cheapest ride XY3, but got %s", it.Legs[0].Ride.ID)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Quote picks the ride, or chain of rides, that SelectRide would book for the
+// given preference, without reserving seats or touching ride statistics.
+func (rm *rideManager) Quote(source, destination string, seats int, preference string, window TimeWindow) (Itinerary, error) {
+	prefs, err := parsePreference(preference)
+	if err != nil {
+		return Itinerary{}, err
+	}
+	return rm.QuoteWithPreferences(source, destination, seats, prefs, window)
+}
+
+// QuoteWithPreferences is Quote for preferences that are already parsed.
+func (rm *rideManager) QuoteWithPreferences(source, destination string, seats int, prefs SelectionPreferences, window TimeWindow) (Itinerary, error) {
+	rm.recordSearch(source, destination)
+	return rm.quoteWithPreferences(source, destination, seats, prefs, window)
+}
+
+// quoteWithPreferences quotes without counting a search, so SelectRide can
+// quote again after losing seats without adding to demand.
+func (rm *rideManager) quoteWithPreferences(source, destination string, seats int, prefs SelectionPreferences, window TimeWindow) (Itinerary, error) {
+	strategy, err := rm.strategies.Resolve(prefs.strategy())
+	if err != nil {
+		return Itinerary{}, err
+	}
+	vehicle := prefs.vehicle()
+	it, err := rm.quote(source, destination, seats, prefs.minSeats(seats), vehicle, strategy, window)
+	strictErr := err
+	var reasons []string
+	for errors.Is(err, ErrNoMatchingVehicle) && vehicle.Degrade {
+		relaxed, reason, ok := vehicle.relax()
+		if !ok {
+			return Itinerary{}, strictErr
+		}
+		vehicle, reasons = relaxed, append(reasons, reason)
+		it, err = rm.quote(source, destination, seats, prefs.minSeats(seats), vehicle, strategy, window)
+	}
+	if err != nil {
+		return Itinerary{}, err
+	}
+	it.Degraded = strings.Join(reasons, "; ")
+	return it, nil
+}
+
+// quote picks among direct rides with at least minSeats free in a vehicle
+// matching vehicle, or failing that routes through connecting rides that all
+// match it. It fails with ErrNoMatchingVehicle when only the vehicle stands in
+// the way.
+func (rm *rideManager) quote(source, destination string, seats, minSeats int, vehicle VehiclePreference, strategy RideSelectionStrategy, window TimeWindow) (Itinerary, error) {
+	rm.mu.Lock()
+	fare, objective := rm.fareFunc, rm.routeObjective
+	rm.mu.Unlock()
+	surge := rm.surgeMultiplier(source, destination)
+
+	var candidates []Ride
+	seated := false
+	for _, ride := range rm.GetDirectRides(source, destination, window) {
+		if ride.AvailableSeats < minSeats {
+			continue
+		}
+		seated = true
+		if rm.isPreferredVehicle(ride.VehicleID, vehicle) {
+			candidates = append(candidates, ride)
+		}
+	}
+	if len(candidates) == 0 {
+		// No direct ride will do, so look for a chain of rides that meets
+		// the vehicle preference before anything relaxes it.
+		opts := RouteOptions{Objective: objective, Vehicle: vehicle, Window: window}
+		legs, err := rm.FindRoute(source, destination, minSeats, opts)
+		if err != nil {
+			// A ride or route in any vehicle means only the vehicle stood in
+			// the way.
+			opts.Vehicle = VehiclePreference{}
+			if _, anyErr := rm.FindRoute(source, destination, minSeats, opts); seated || anyErr == nil {
+				err = ErrNoMatchingVehicle
+			}
+			return Itinerary{}, fmt.Errorf("failed to find indirect routes: %w", err)
+		}
+		return rm.newItinerary(legs, seats, surge), nil
+	}
+	sortRidesByID(candidates)
+	req := SelectionRequest{Seats: seats, Vehicle: rm.vehicleMgr.GetVehicleByID}
+	if fare != nil || driverPriced(candidates) {
+		req.Fare = func(ride Ride) float64 { return rm.legFare(ride, seats, fare, surge) }
+	}
+	selectedRide, ok := strategy.Select(candidates, req)
+	if !ok {
+		return Itinerary{}, fmt.Errorf("no suitable ride found")
+	}
+	return rm.newItinerary([]Ride{selectedRide}, seats, surge), nil
+}
+
+// newItinerary describes legs as a bookable option for seats, with scheduled
+// fares raised by surge.
+func (rm *rideManager) newItinerary(legs []Ride, seats int, surge float64) Itinerary {
+	rm.mu.Lock()
+	fare := rm.fareFunc
+	rm.mu.Unlock()
+
+	it := Itinerary{
+		ID:              fmt.Sprintf("I%d", rm.itinerarySeq.Add(1)),
+		Seats:           seats,
+		SurgeMultiplier: surge,
+		ExpiresAt:       rm.now().Add(itineraryTTL),
+	}
+	for i, ride := range legs {
+		leg := ItineraryLeg{Ride: ride}
+		if vehicle, err := rm.vehicleMgr.GetVehicleByID(ride.VehicleID); err == nil {
+			leg.VehicleModel = vehicle.Model
+		}
+		if stored, err := rm.storage.GetRideByID(ride.ID); err == nil {
+			leg.Segments = stored.Availability()
+		}
+		leg.Distance, _ = rm.legDistance(ride)
+		leg.Fare = rm.legFare(ride, seats, fare, surge)
+		it.Price = roundFare(it.Price + leg.Fare*float64(seats))
+		if i == 0 || ride.AvailableSeats < it.AvailableSeats {
+			it.AvailableSeats = ride.AvailableSeats
+		}
+		it.Legs = append(it.Legs, leg)
+	}
+	it.JourneyTime, it.Transfers = journeyTiming(legs)
+	return it
+}
+
+// bookItinerary reserves every leg of it, or none, and records the booking.
+// A direct booking reports the ride's remaining seats, as SelectRide always
+// has; the legs of a chain are reported as quoted.
+func (rm *rideManager) bookItinerary(userID string, it Itinerary) (Booking, error) {
+	if rm.now().After(it.ExpiresAt) {
+		return Booking{}, fmt.Errorf("itinerary %s has expired", it.ID)
+	}
+	legs := it.Rides()
+	reserved, err := rm.reserveLegs(userID, legs, it.Seats)
+	if err != nil {
+		return Booking{}, err
+	}
+	if len(legs) == 1 {
+		legs = reserved
+	}
+	booking, err := rm.createBooking(userID, legs, it)
+	if err != nil {
+		if rbErr := rm.rollbackLegs(userID, legs, it.Seats); rbErr != nil {
+			return Booking{}, fmt.Errorf("%v; rollback failed: %v", err, rbErr)
+		}
+		return Booking{}, err
+	}
+	return booking, nil
+}
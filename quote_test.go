@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// Test that quoting leaves seats and statistics untouched and matches what SelectRide books
+func TestQuoteIsReadOnly(t *testing.T) {
+	rideMgr, rideStorage := newRoutingFixture(t)
+	before := rideStorage.GetAllRides()
+
+	direct, err := rideMgr.Quote("A", "B", 2, string(MostVacantSeats), TimeWindow{})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	indirect, err := rideMgr.Quote("A", "D", 2, string(MostVacantSeats), TimeWindow{})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(direct.Legs) != 1 || len(indirect.Legs) != 2 {
+		t.Fatalf("Expected a direct and a two-leg quote, but got %d and %d legs", len(direct.Legs), len(indirect.Legs))
+	}
+
+	after := rideStorage.GetAllRides()
+	for id, ride := range before {
+		if !reflect.DeepEqual(after[id], ride) {
+			t.Fatalf("Expected quoting not to modify ride %s, but got %+v", id, after[id])
+		}
+	}
+	if taken := rideMgr.rideStats["p1"].taken; taken != 0 {
+		t.Fatalf("Expected no rides taken, but got %d", taken)
+	}
+
+	booking, err := rideMgr.SelectRide("p1", "A", "D", 2, string(MostVacantSeats))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if got, want := fmt.Sprint(booking.RideIDs()), fmt.Sprint(Booking{Legs: indirect.Rides()}.RideIDs()); got != want {
+		t.Fatalf("Expected SelectRide to book the quoted route %s, but got %s", want, got)
+	}
+	if taken := rideMgr.rideStats["p1"].taken; taken != 2 {
+		t.Fatalf("Expected 2 rides taken, but got %d", taken)
+	}
+}
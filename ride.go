@@ -1,34 +1,136 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// Strategy names a built-in RideSelectionStrategy.
 type Strategy string
 
 const (
-	PreferredVehicle Strategy = "Preferred Vehicle"
-	MostVacantSeats  Strategy = "Most Vacant"
+	PreferredVehicle  Strategy = "Preferred Vehicle"
+	MostVacantSeats   Strategy = "Most Vacant"
+	EarliestDeparture Strategy = "Earliest Departure"
+	CheapestRide      Strategy = "Lowest Fare"
 )
 
 type Ride struct {
-	ID             string
-	DriverID       string
-	VehicleID      string
-	Source         string
-	Destination    string
-	AvailableSeats int
+	ID               string
+	DriverID         string
+	VehicleID        string
+	Source           string
+	Destination      string
+	SourceLocation   Location   // set by OfferRide when Source is a registered place
+	Stops            []Waypoint // intermediate stops in travel order
+	AvailableSeats   int        // seats free on every segment of the route
+	SegmentSeats     []int      // seats free on each segment of Route(); nil when the ride has no stops
+	Pricing          PricingMode
+	SeatContribution float64 // per seat, for PerSeatContribution
+	TripCost         float64 // whole trip, for SplitCost
+	Version          int     // bumped by RideStorage on every update
+	Status           RideStatus
+	DepartureTime    time.Time // zero for a ride leaving as soon as it is offered
+	ArrivalTime      time.Time
+}
+
+// IsScheduled reports whether the ride has a departure time.
+func (r Ride) IsScheduled() bool {
+	return !r.DepartureTime.IsZero()
+}
+
+// overlaps reports whether two rides could need the same driver or vehicle at
+// the same time. Unscheduled rides have no end, so they overlap everything.
+func (r Ride) overlaps(other Ride) bool {
+	if !r.IsScheduled() || !other.IsScheduled() {
+		return true
+	}
+	return r.DepartureTime.Before(other.ArrivalTime) && other.DepartureTime.Before(r.ArrivalTime)
+}
+
+// TimeWindow bounds the departure times a passenger will accept. A zero From
+// or To leaves that side open; the zero TimeWindow accepts any ride.
+type TimeWindow struct {
+	From time.Time
+	To   time.Time
+}
+
+func (w TimeWindow) IsZero() bool {
+	return w.From.IsZero() && w.To.IsZero()
+}
+
+// Admits reports whether a ride departs within the window. Unscheduled rides
+// are only admitted by the zero window.
+func (w TimeWindow) Admits(ride Ride) bool {
+	if w.IsZero() {
+		return true
+	}
+	if !ride.IsScheduled() {
+		return false
+	}
+	if !w.From.IsZero() && ride.DepartureTime.Before(w.From) {
+		return false
+	}
+	if !w.To.IsZero() && ride.DepartureTime.After(w.To) {
+		return false
+	}
+	return true
+}
+
+// LegBookingError reports which leg of a multi-leg route could not be booked.
+type LegBookingError struct {
+	Leg  int // 1-based position of the leg in the route
+	Ride Ride
+	Err  error
+}
+
+func (e *LegBookingError) Error() string {
+	return fmt.Sprintf("could not book leg %d (ride %s from %s to %s): %v", e.Leg, e.Ride.ID, e.Ride.Source, e.Ride.Destination, e.Err)
+}
+
+func (e *LegBookingError) Unwrap() error {
+	return e.Err
+}
+
+// SeatsUnavailableError is returned when a ride no longer has the seats a
+// passenger asked for, typically because another booking got there first.
+type SeatsUnavailableError struct {
+	RideID    string
+	Requested int
+	Available int
+}
+
+func (e *SeatsUnavailableError) Error() string {
+	return fmt.Sprintf("seats no longer available on ride %s: requested %d, available %d", e.RideID, e.Requested, e.Available)
 }
 
 type rideManager struct {
-	mu          sync.Mutex
-	storage     RideStorage
-	rideStats   map[string]stats // total rides offered/taken by user
-	userMgr     *userManager
-	vehicleMgr  *vehicleManager
-	activeRides map[string]bool // Mapping of ride ID to active status
+	mu             sync.Mutex
+	storage        RideStorage
+	rideStats      map[string]stats // total rides offered/taken by user
+	userMgr        *userManager
+	vehicleMgr     *vehicleManager
+	layovers       layoverLimits
+	routeObjective RouteObjective
+	fareFunc       func(Ride) float64
+	surge          *surgeTracker  // nil until SetSurgePolicy
+	ledger         *ledgerManager // nil until SetLedger
+	platformFee    float64        // fraction of each payment kept by the platform
+	strategies     *StrategyRegistry
+	places         *placeManager
+	walkingRadius  float64 // metres a passenger will walk to a pickup or from a drop-off
+	bookings       BookingStorage
+	bookingSeq     atomic.Int64
+	bookingMu      sync.Mutex    // serializes creating and cancelling bookings
+	cancelWindow   time.Duration // how long before departure cancelling closes; 0 means no limit
+	cancelPolicy   CancellationPolicy
+	itineraryMu    sync.Mutex
+	itineraries    map[string]Itinerary // search results awaiting BookItinerary
+	itinerarySeq   atomic.Int64
+	now            func() time.Time
 }
 
 type stats struct {
@@ -36,57 +138,111 @@ type stats struct {
 	taken   int
 }
 
-func NewRideManager(storage RideStorage, usersMgr *userManager, vehicleMgr *vehicleManager) *rideManager {
-	return &rideManager{
+func NewRideManager(storage RideStorage, bookings BookingStorage, usersMgr *userManager, vehicleMgr *vehicleManager) *rideManager {
+	rm := &rideManager{
 		mu:          sync.Mutex{},
 		storage:     storage,
 		rideStats:   make(map[string]stats),
-		activeRides: make(map[string]bool),
 		userMgr:     usersMgr,
 		vehicleMgr:  vehicleMgr,
+		bookings:    bookings,
+		itineraries: make(map[string]Itinerary),
+		strategies:  defaultStrategies,
+		now:         time.Now,
 	}
+	// Bookings are never deleted, so continuing from the count keeps IDs unique.
+	rm.bookingSeq.Store(int64(len(bookings.GetAllBookings())))
+	rm.loadStats()
+	return rm
 }
 
-func (rm *rideManager) GetDirectRides(source, destination string) []Ride {
-	var result []Ride
+// loadStats counts the rides offered and taken so far from storage, so
+// statistics carry over when the manager is created on existing data.
+func (rm *rideManager) loadStats() {
 	for _, ride := range rm.storage.GetAllRides() {
-		if ride.Source == source && ride.Destination == destination && ride.AvailableSeats > 0 {
+		stats := rm.rideStats[ride.DriverID]
+		stats.offered++
+		rm.rideStats[ride.DriverID] = stats
+	}
+	for _, booking := range rm.bookings.GetAllBookings() {
+		if booking.Status != BookingConfirmed {
+			continue
+		}
+		stats := rm.rideStats[booking.PassengerID]
+		stats.taken += len(booking.Legs)
+		rm.rideStats[booking.PassengerID] = stats
+	}
+}
+
+// GetDirectRides retrieves bookable rides from source to destination that
+// depart within window. With places set, rides starting and ending within
+// walking distance of source and destination also match.
+func (rm *rideManager) GetDirectRides(source, destination string, window TimeWindow) []Ride {
+	return rm.directRides(rm.walkable(source), rm.walkable(destination), window)
+}
+
+// GetDirectRidesNear is GetDirectRides for a passenger at arbitrary
+// coordinates rather than at registered places.
+func (rm *rideManager) GetDirectRidesNear(origin, destination Location, window TimeWindow) []Ride {
+	rm.mu.Lock()
+	radius := rm.walkingRadius
+	rm.mu.Unlock()
+	destinations := rm.walkableFrom(destination)
+	var result []Ride
+	for _, ride := range rm.storage.GetRidesNear(origin, radius) {
+		if destinations[ride.Destination] && ride.AvailableSeats > 0 && ride.Status.AcceptsBookings() && window.Admits(ride) {
 			result = append(result, ride)
 		}
 	}
 	return result
 }
 
-// GetRidesByVehicle retrieves all rides associated with a vehicle.
-func (rm *rideManager) GetRidesByVehicle(vehicleID string) []Ride {
-	var vehicleRides []Ride
-	for _, ride := range rm.storage.GetAllRides() {
-		if ride.VehicleID == vehicleID {
-			vehicleRides = append(vehicleRides, ride)
+// GetRidesNear retrieves bookable rides departing within radius metres of
+// center and within window, nearest first. Only rides offered from registered
+// places have coordinates.
+func (rm *rideManager) GetRidesNear(center Location, radius float64, window TimeWindow) []Ride {
+	var result []Ride
+	for _, ride := range rm.storage.GetRidesNear(center, radius) {
+		if ride.AvailableSeats > 0 && ride.Status.AcceptsBookings() && window.Admits(ride) {
+			result = append(result, ride)
 		}
 	}
-	return vehicleRides
+	return result
+}
+
+func (rm *rideManager) directRides(sources, destinations map[string]bool, window TimeWindow) []Ride {
+	var result []Ride
+	for source := range sources {
+		for destination := range destinations {
+			for _, ride := range rm.storage.GetRidesByRoute(source, destination) {
+				segment, _ := ride.Segment(source, destination)
+				if segment.AvailableSeats > 0 && segment.Status.AcceptsBookings() && window.Admits(segment) {
+					result = append(result, segment)
+				}
+			}
+		}
+	}
+	return result
 }
 
+// GetRidesByVehicle retrieves all rides associated with a vehicle.
+func (rm *rideManager) GetRidesByVehicle(vehicleID string) []Ride {
+	return rm.storage.GetRidesByVehicle(vehicleID)
+}
+
+// GetRidesBySource retrieves all rides starting at, or within walking distance
+// of, source.
 func (rm *rideManager) GetRidesBySource(source string) []Ride {
 	var rides []Ride
-	for _, ride := range rm.storage.GetAllRides() {
-		if ride.Source == source {
-			rides = append(rides, ride)
-		}
+	for place := range rm.walkable(source) {
+		rides = append(rides, rm.storage.GetRidesBySource(place)...)
 	}
 	return rides
 }
 
 // GetRidesByDriver retrieves all rides associated with a driver.
 func (rm *rideManager) GetRidesByDriver(driverID string) []Ride {
-	var driverRides []Ride
-	for _, ride := range rm.storage.GetAllRides() {
-		if ride.DriverID == driverID {
-			driverRides = append(driverRides, ride)
-		}
-	}
-	return driverRides
+	return rm.storage.GetRidesByDriver(driverID)
 }
 
 func (rm *rideManager) OfferRide(ride Ride) error {
@@ -98,46 +254,69 @@ func (rm *rideManager) OfferRide(ride Ride) error {
 		return err
 	}
 
-	// Check if the driver is already offering a ride
+	if ride.Status != "" && ride.Status != RideOffered {
+		return fmt.Errorf("a new ride must be %s, not %s", RideOffered, ride.Status)
+	}
+	if ride.IsScheduled() {
+		if !ride.ArrivalTime.After(ride.DepartureTime) {
+			return fmt.Errorf("ride %s must arrive after it departs", ride.ID)
+		}
+		if ride.DepartureTime.Before(rm.now()) {
+			return fmt.Errorf("ride %s departs in the past", ride.ID)
+		}
+	} else if !ride.ArrivalTime.IsZero() {
+		return fmt.Errorf("ride %s has an arrival time but no departure time", ride.ID)
+	}
+	if err := ride.validatePricing(); err != nil {
+		return err
+	}
+	ride.SegmentSeats = nil
+	if len(ride.Stops) > 0 {
+		if err := ride.validateStops(); err != nil {
+			return err
+		}
+		ride.SegmentSeats = make([]int, len(ride.Stops)+1)
+		for i := range ride.SegmentSeats {
+			ride.SegmentSeats[i] = ride.AvailableSeats
+		}
+	}
+	ride.Status = RideOffered
+	if loc, ok := rm.locate(ride.Source); ok {
+		ride.SourceLocation = loc
+	}
+
+	// Hold the lock from the conflict checks until the ride is stored so two
+	// concurrent offers for the same driver or vehicle can't both pass.
+	rm.mu.Lock()
+	// Check if the driver is already offering a ride at the same time
 	for _, existingRide := range rm.GetRidesByDriver(ride.DriverID) {
-		if rm.isActive(existingRide.ID) {
-			return fmt.Errorf("driver %s is already offering a ride", ride.DriverID)
+		if existingRide.Status.IsActive() && existingRide.overlaps(ride) {
+			rm.mu.Unlock()
+			return fmt.Errorf("driver %s is already offering a ride at that time", ride.DriverID)
 		}
 	}
 
-	// Check if the vehicle is already in use for a ride
+	// Check if the vehicle is already in use for a ride at the same time
 	for _, existingRide := range rm.GetRidesByVehicle(ride.VehicleID) {
-		if rm.isActive(existingRide.ID) {
-			return fmt.Errorf("vehicle %s is already in use for a ride", ride.VehicleID)
+		if existingRide.Status.IsActive() && existingRide.overlaps(ride) {
+			rm.mu.Unlock()
+			return fmt.Errorf("vehicle %s is already in use for a ride at that time", ride.VehicleID)
 		}
 	}
 
 	// If no conflicts, add the ride
 	if err := rm.storage.AddRide(ride); err != nil {
+		rm.mu.Unlock()
 		return fmt.Errorf("could not offer ride: %v", err)
 	}
-	rm.activeRides[ride.ID] = true
+	rm.mu.Unlock()
 	fmt.Printf("Ride offered: %+v\n", ride)
+	rm.recordOffer(ride)
 
 	rm.updateOfferedStats(ride.DriverID)
 	return nil
 }
 
-// isActive checks if a ride is active.
-func (rm *rideManager) isActive(rideID string) bool {
-	_, isActive := rm.activeRides[rideID]
-	return isActive
-}
-
-func (rm *rideManager) EndRide(rideID string) error {
-	if err := rm.storage.DeleteRide(rideID); err != nil {
-		return fmt.Errorf("could not end ride: %v", err)
-	}
-	delete(rm.activeRides, rideID)
-	fmt.Printf("Ride ended: %v\n", rideID)
-	return nil
-}
-
 func (rm *rideManager) PrintRideStats() {
 	fmt.Println("Ride statistics:")
 	rm.mu.Lock()
@@ -147,12 +326,12 @@ func (rm *rideManager) PrintRideStats() {
 	rm.mu.Unlock()
 }
 
-func (rm *rideManager) isPreferredVehicle(vehicleID, preferredVehicle string) bool {
+func (rm *rideManager) isPreferredVehicle(vehicleID string, preferred VehiclePreference) bool {
 	vehicle, err := rm.vehicleMgr.GetVehicleByID(vehicleID)
 	if err != nil {
 		return false
 	}
-	return len(preferredVehicle) == 0 || vehicle.Model == preferredVehicle
+	return preferred.Matches(vehicle)
 }
 
 func (rm *rideManager) incrementTakenStats(userID string) {
@@ -178,99 +357,127 @@ func (rm *rideManager) updateOfferedStats(driverID string) {
 	rm.rideStats[driverID] = stats
 }
 
-// FindRides finds rides for the given source, destination, and required seats
-func (rm *rideManager) FindInDirectRoute(userID, source, destination string, seats int, preferredVehicle string) ([]Ride, error) {
-	var selectedRides []Ride
-	visited := make(map[string]bool)
-
-	var dfs func(current, dest string) bool
-	dfs = func(current, dest string) bool {
-		if current == dest {
-			return true
-		}
-
-		visited[current] = true
-
-		// Find rides from the current source
-		rides := rm.GetRidesBySource(current)
-
-		// Iterate through rides to find possible paths
-		for _, ride := range rides {
-			if !visited[ride.Destination] && ride.AvailableSeats >= seats && rm.isPreferredVehicle(ride.VehicleID, preferredVehicle) {
-				selectedRides = append(selectedRides, ride)
-				rm.incrementTakenStats(userID)
-				ride.AvailableSeats -= seats
-				rm.storage.UpdateRide(ride)
-				if dfs(ride.Destination, dest) {
-					return true
-				}
-				selectedRides = selectedRides[:len(selectedRides)-1] // Backtrack
-				rm.decrementTakenStats(userID)
-				ride.AvailableSeats += seats
-				rm.storage.UpdateRide(ride)
-			}
+// rollbackLegs releases the seats held on every leg, attempting all of them
+// even if some fail.
+func (rm *rideManager) rollbackLegs(userID string, legs []Ride, seats int) error {
+	var errs []error
+	for i := len(legs) - 1; i >= 0; i-- {
+		if err := rm.releaseSeats(legs[i], seats); err != nil {
+			errs = append(errs, fmt.Errorf("leg %d (ride %s): %v", i+1, legs[i].ID, err))
+			continue
 		}
-		return false
-	}
-
-	// Perform DFS from the source to find rides to the destination
-	if !dfs(source, destination) {
-		return nil, fmt.Errorf("no rides available for the route")
+		rm.decrementTakenStats(userID)
 	}
+	return errors.Join(errs...)
+}
 
-	return selectedRides, nil
+func (rm *rideManager) SelectRide(userID, source, destination string, seats int, preference string) (Booking, error) {
+	return rm.SelectRideInWindow(userID, source, destination, seats, preference, TimeWindow{})
 }
 
-func (rm *rideManager) SelectRide(userID, source, destination string, seats int, preference string) ([]Ride, error) {
-	strategy := preference
-	preferedVehicle := ""
-	if strategy != string(MostVacantSeats) {
-		strategy, preferedVehicle = strings.Split(strategy, "=")[0], strings.Split(strategy, "=")[1]
+// SelectRideInWindow is SelectRide restricted to rides departing within window.
+// It books exactly what Quote returns, quoting again if a concurrent booking
+// takes the seats first.
+func (rm *rideManager) SelectRideInWindow(userID, source, destination string, seats int, preference string, window TimeWindow) (Booking, error) {
+	prefs, err := parsePreference(preference)
+	if err != nil {
+		return Booking{}, err
 	}
+	return rm.SelectRideWithPreferences(userID, source, destination, seats, prefs, window)
+}
 
-	rides := rm.GetDirectRides(source, destination)
-	if len(rides) == 0 {
-		fmt.Println("No rides available directly: searching for rides through indirect routes.")
-		indirectRoute, err := rm.FindInDirectRoute(userID, source, destination, seats, preferedVehicle)
+// SelectRideWithPreferences is SelectRideInWindow for preferences that are
+// already parsed.
+func (rm *rideManager) SelectRideWithPreferences(userID, source, destination string, seats int, prefs SelectionPreferences, window TimeWindow) (Booking, error) {
+	rm.recordSearch(source, destination)
+	var lastErr error
+	for attempt := 0; attempt < maxRouteAttempts; attempt++ {
+		it, err := rm.quoteWithPreferences(source, destination, seats, prefs, window)
 		if err != nil {
-			return nil, fmt.Errorf("failed to find indirect routes: %v", err)
-		}
-		fmt.Printf("Indirect Rides selected: %+v\n", indirectRoute)
-		return indirectRoute, nil
-	}
-
-	var selectedRide Ride
-	switch strategy {
-	case string(PreferredVehicle):
-		for _, ride := range rides {
-			vehicle, _ := rm.vehicleMgr.GetVehicleByID(ride.VehicleID)
-			if vehicle.Model == preferedVehicle && ride.AvailableSeats >= seats {
-				selectedRide = ride
-				break
+			if lastErr != nil {
+				return Booking{}, lastErr // the seats we lost were the last ones
 			}
+			return Booking{}, err
+		}
+		if len(it.Legs) > 1 {
+			fmt.Println("No rides available directly: searching for rides through indirect routes.")
+		}
+		if it.Degraded != "" {
+			fmt.Printf("Vehicle preference relaxed: %v\n", it.Degraded)
 		}
-	case string(MostVacantSeats):
-		maxSeats := -1
-		for _, ride := range rides {
-			if ride.AvailableSeats >= seats && ride.AvailableSeats > maxSeats {
-				maxSeats = ride.AvailableSeats
-				selectedRide = ride
+		if it.SurgeMultiplier > 1 {
+			fmt.Printf("Surge pricing applied: x%.2f\n", it.SurgeMultiplier)
+		}
+		booking, err := rm.bookItinerary(userID, it)
+		if err == nil {
+			if len(it.Legs) > 1 {
+				fmt.Printf("Indirect Rides selected: %+v\n", booking.Legs)
+			} else {
+				fmt.Printf("Ride selected: %+v\n", booking.Legs[0])
 			}
+			booking.printConfirmation()
+			return booking, nil
+		}
+		if !isSeatsUnavailable(err) {
+			return Booking{}, err
 		}
-	default:
-		return nil, fmt.Errorf("unknown selection strategy")
+		lastErr = err
 	}
+	return Booking{}, lastErr
+}
 
-	if selectedRide.ID == "" {
-		return nil, fmt.Errorf("no suitable ride found")
+// reserveSeats atomically takes seats on the segments of a ride that leg
+// travels, retrying on concurrent updates, and returns leg as updated. It
+// returns a *SeatsUnavailableError once any of those segments is too full.
+func (rm *rideManager) reserveSeats(leg Ride, seats int) (Ride, error) {
+	for {
+		ride, err := rm.storage.GetRideByID(leg.ID)
+		if err != nil {
+			return Ride{}, fmt.Errorf("could not reserve seats: %v", err)
+		}
+		if !ride.Status.AcceptsBookings() {
+			return Ride{}, fmt.Errorf("ride %s is %s and no longer accepts bookings", leg.ID, ride.Status)
+		}
+		from, to, ok := ride.segmentRange(leg.Source, leg.Destination)
+		if !ok {
+			return Ride{}, fmt.Errorf("ride %s does not go from %s to %s", leg.ID, leg.Source, leg.Destination)
+		}
+		segment, _ := ride.Segment(leg.Source, leg.Destination)
+		if segment.AvailableSeats < seats {
+			return Ride{}, &SeatsUnavailableError{RideID: leg.ID, Requested: seats, Available: segment.AvailableSeats}
+		}
+		ride.adjustSeats(from, to, -seats)
+		err = rm.storage.CompareAndUpdateRide(ride)
+		if err == nil {
+			ride.Version++
+			segment, _ = ride.Segment(leg.Source, leg.Destination)
+			return segment, nil
+		}
+		if !errors.Is(err, ErrVersionConflict) {
+			return Ride{}, fmt.Errorf("could not update ride: %v", err)
+		}
 	}
+}
 
-	selectedRide.AvailableSeats -= seats
-	if err := rm.storage.UpdateRide(selectedRide); err != nil {
-		return nil, fmt.Errorf("could not update ride: %v", err)
+// releaseSeats atomically returns seats on the segments of a ride that leg
+// travels, retrying on concurrent updates.
+func (rm *rideManager) releaseSeats(leg Ride, seats int) error {
+	for {
+		ride, err := rm.storage.GetRideByID(leg.ID)
+		if err != nil {
+			return fmt.Errorf("could not release seats: %v", err)
+		}
+		from, to, ok := ride.segmentRange(leg.Source, leg.Destination)
+		if !ok {
+			return fmt.Errorf("ride %s does not go from %s to %s", leg.ID, leg.Source, leg.Destination)
+		}
+		ride.adjustSeats(from, to, seats)
+		err = rm.storage.CompareAndUpdateRide(ride)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, ErrVersionConflict) {
+			return fmt.Errorf("could not update ride: %v", err)
+		}
 	}
-
-	fmt.Printf("Ride selected: %+v\n", selectedRide)
-	rm.incrementTakenStats(userID)
-	return []Ride{selectedRide}, nil
 }
@@ -0,0 +1,95 @@
+package main
+
+import "sort"
+
+type routeKey struct {
+	source, destination string
+}
+
+// rideIndex holds the secondary indexes ride storages keep alongside their
+// ride maps. Each index maps a key to the set of ride IDs having it. It is not
+// safe for concurrent use; ride storages guard it with their own lock.
+type rideIndex struct {
+	byDriver  map[string]map[string]bool
+	byVehicle map[string]map[string]bool
+	bySource  map[string]map[string]bool
+	byRoute   map[routeKey]map[string]bool
+	byStatus  map[RideStatus]map[string]bool
+	grid      *rideGrid
+}
+
+func newRideIndex() *rideIndex {
+	return &rideIndex{
+		byDriver:  make(map[string]map[string]bool),
+		byVehicle: make(map[string]map[string]bool),
+		bySource:  make(map[string]map[string]bool),
+		byRoute:   make(map[routeKey]map[string]bool),
+		byStatus:  make(map[RideStatus]map[string]bool),
+		grid:      newRideGrid(),
+	}
+}
+
+func addTo[K comparable](index map[K]map[string]bool, key K, id string) {
+	if index[key] == nil {
+		index[key] = make(map[string]bool)
+	}
+	index[key][id] = true
+}
+
+func removeFrom[K comparable](index map[K]map[string]bool, key K, id string) {
+	delete(index[key], id)
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
+
+// routeKeys returns every (board, alight) pair a passenger can travel on
+// ride.
+func routeKeys(ride Ride) []routeKey {
+	route := ride.Route()
+	var keys []routeKey
+	for i := range route {
+		for j := i + 1; j < len(route); j++ {
+			keys = append(keys, routeKey{route[i], route[j]})
+		}
+	}
+	return keys
+}
+
+func (idx *rideIndex) add(ride Ride) {
+	addTo(idx.byDriver, ride.DriverID, ride.ID)
+	addTo(idx.byVehicle, ride.VehicleID, ride.ID)
+	for _, key := range routeKeys(ride) {
+		addTo(idx.bySource, key.source, ride.ID)
+		addTo(idx.byRoute, key, ride.ID)
+	}
+	addTo(idx.byStatus, ride.Status, ride.ID)
+	idx.grid.add(ride)
+}
+
+func (idx *rideIndex) remove(ride Ride) {
+	removeFrom(idx.byDriver, ride.DriverID, ride.ID)
+	removeFrom(idx.byVehicle, ride.VehicleID, ride.ID)
+	for _, key := range routeKeys(ride) {
+		removeFrom(idx.bySource, key.source, ride.ID)
+		removeFrom(idx.byRoute, key, ride.ID)
+	}
+	removeFrom(idx.byStatus, ride.Status, ride.ID)
+	idx.grid.remove(ride)
+}
+
+// replace re-indexes a ride whose stored version was old.
+func (idx *rideIndex) replace(old, ride Ride) {
+	idx.remove(old)
+	idx.add(ride)
+}
+
+// ridesFor returns the rides with the given IDs, ordered by ID.
+func ridesFor(rides map[string]Ride, ids map[string]bool) []Ride {
+	result := make([]Ride, 0, len(ids))
+	for id := range ids {
+		result = append(result, rides[id])
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+type RideStatus string
+
+const (
+	RideOffered    RideStatus = "Offered"
+	RideBoarding   RideStatus = "Boarding"
+	RideInProgress RideStatus = "InProgress"
+	RideCompleted  RideStatus = "Completed"
+	RideCancelled  RideStatus = "Cancelled"
+)
+
+// rideTransitions lists the statuses each status may move to.
+var rideTransitions = map[RideStatus][]RideStatus{
+	RideOffered:    {RideBoarding, RideInProgress, RideCancelled},
+	RideBoarding:   {RideInProgress, RideCancelled},
+	RideInProgress: {RideCompleted},
+}
+
+// CanTransitionTo reports whether a ride may move from s to next.
+func (s RideStatus) CanTransitionTo(next RideStatus) bool {
+	for _, allowed := range rideTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUnderWay reports whether a ride in this status has set off.
+func (s RideStatus) IsUnderWay() bool {
+	return s == RideInProgress || s == RideCompleted
+}
+
+// IsActive reports whether a ride in this status still occupies its driver
+// and vehicle.
+func (s RideStatus) IsActive() bool {
+	return s == RideOffered || s == RideBoarding || s == RideInProgress
+}
+
+// bookableStatuses are the statuses for which AcceptsBookings is true.
+var bookableStatuses = []RideStatus{RideOffered, RideBoarding}
+
+// AcceptsBookings reports whether passengers may still book or cancel seats.
+func (s RideStatus) AcceptsBookings() bool {
+	return s == RideOffered || s == RideBoarding
+}
+
+// BoardRide marks an offered ride as boarding passengers.
+func (rm *rideManager) BoardRide(rideID string) error {
+	return rm.transitionRide(rideID, RideBoarding)
+}
+
+// StartRide marks a ride as under way; no further bookings are accepted.
+func (rm *rideManager) StartRide(rideID string) error {
+	return rm.transitionRide(rideID, RideInProgress)
+}
+
+// CompleteRide marks a ride as finished and pays its driver. The ride stays in
+// storage as history.
+func (rm *rideManager) CompleteRide(rideID string) error {
+	if err := rm.transitionRide(rideID, RideCompleted); err != nil {
+		return err
+	}
+	if err := rm.settleRide(rideID); err != nil {
+		return fmt.Errorf("ride %s completed but not paid out: %v", rideID, err)
+	}
+	return nil
+}
+
+// CancelRide cancels a ride before it starts and cancels every booking on it,
+// returning the passengers' seats on their other legs and refunding them in
+// full. A passenger already travelling an earlier leg keeps the legs under
+// way and is refunded for the rest.
+func (rm *rideManager) CancelRide(rideID, reason string) error {
+	rm.bookingMu.Lock()
+	defer rm.bookingMu.Unlock()
+	if err := rm.transitionRide(rideID, RideCancelled); err != nil {
+		return err
+	}
+	var errs []error
+	for _, booking := range rm.GetBookingsByRide(rideID) {
+		if booking.Status != BookingConfirmed {
+			continue
+		}
+		var err error
+		if rm.journeyUnderWay(booking) {
+			err = rm.dropUnstartedLegs(booking, "ride cancelled by driver: "+reason)
+		} else {
+			err = rm.cancelBooking(booking, BookingCancelled, "ride cancelled by driver: "+reason, 0)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// journeyUnderWay reports whether any ride booked by booking has set off.
+func (rm *rideManager) journeyUnderWay(booking Booking) bool {
+	for _, leg := range booking.Legs {
+		if ride, err := rm.storage.GetRideByID(leg.ID); err == nil && ride.Status.IsUnderWay() {
+			return true
+		}
+	}
+	return false
+}
+
+// EndRide finishes a ride, starting it first if the driver never did. A ride
+// still offered with passengers booked was never travelled, so it must be
+// started or cancelled rather than ended.
+func (rm *rideManager) EndRide(rideID string) error {
+	if err := rm.startUnstarted(rideID); err != nil {
+		return fmt.Errorf("could not end ride: %v", err)
+	}
+	if err := rm.CompleteRide(rideID); err != nil {
+		return fmt.Errorf("could not end ride: %v", err)
+	}
+	return nil
+}
+
+// startUnstarted starts a ride that is not yet under way, refusing an offered
+// ride that has confirmed bookings.
+func (rm *rideManager) startUnstarted(rideID string) error {
+	rm.bookingMu.Lock()
+	defer rm.bookingMu.Unlock()
+	ride, err := rm.storage.GetRideByID(rideID)
+	if err != nil {
+		return err
+	}
+	switch ride.Status {
+	case RideInProgress:
+		return nil
+	case RideOffered:
+		for _, booking := range rm.GetBookingsByRide(rideID) {
+			if booking.Status == BookingConfirmed {
+				return fmt.Errorf("ride %s has passengers booked but was never started", rideID)
+			}
+		}
+	}
+	return rm.StartRide(rideID)
+}
+
+// transitionRide moves a ride to status next, retrying on concurrent updates.
+func (rm *rideManager) transitionRide(rideID string, next RideStatus) error {
+	for {
+		ride, err := rm.storage.GetRideByID(rideID)
+		if err != nil {
+			return fmt.Errorf("could not find ride %s: %v", rideID, err)
+		}
+		if !ride.Status.CanTransitionTo(next) {
+			return fmt.Errorf("ride %s cannot move from %s to %s", rideID, ride.Status, next)
+		}
+		ride.Status = next
+		err = rm.storage.CompareAndUpdateRide(ride)
+		if err == nil {
+			fmt.Printf("Ride %s: %v\n", next, rideID)
+			return nil
+		}
+		if !errors.Is(err, ErrVersionConflict) {
+			return fmt.Errorf("could not update ride: %v", err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+)
+
+// Test the ride lifecycle and its validated transitions
+func TestRideLifecycle(t *testing.T) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+
+	_ = userMgr.AddUser(User{ID: "1", Name: "Amar", Role: Driver})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4})
+	_ = rideMgr.OfferRide(Ride{ID: "1", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4})
+
+	if err := rideMgr.CompleteRide("1"); err == nil {
+		t.Fatalf("Expected error completing a ride that has not started")
+	}
+	if err := rideMgr.BoardRide("1"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := rideMgr.StartRide("1"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if _, err := rideMgr.SelectRide("3", "A", "B", 1, string(MostVacantSeats)); err == nil {
+		t.Fatalf("Expected error booking a ride in progress")
+	}
+	if err := rideMgr.CancelRide("1", "flat tyre"); err == nil {
+		t.Fatalf("Expected error cancelling a ride in progress")
+	}
+	if err := rideMgr.OfferRide(Ride{ID: "2", DriverID: "1", VehicleID: "1", Source: "B", Destination: "A", AvailableSeats: 4}); err == nil {
+		t.Fatalf("Expected error offering while a ride is in progress")
+	}
+	if err := rideMgr.CompleteRide("1"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := rideMgr.StartRide("1"); err == nil {
+		t.Fatalf("Expected error restarting a completed ride")
+	}
+	if err := rideMgr.OfferRide(Ride{ID: "2", DriverID: "1", VehicleID: "1", Source: "B", Destination: "A", AvailableSeats: 4}); err != nil {
+		t.Fatalf("Expected driver to offer again after completing, but got %v", err)
+	}
+	if history := rideMgr.GetRidesByDriver("1"); len(history) != 2 {
+		t.Fatalf("Expected 2 rides in the driver's history, but got %d", len(history))
+	}
+}
+
+// Test that cancelling a ride cancels its bookings and frees seats on other legs
+func TestCancelRideCancelsBookings(t *testing.T) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+
+	_ = userMgr.AddUser(User{ID: "1", Name: "Amar", Role: Driver})
+	_ = userMgr.AddUser(User{ID: "2", Name: "Chetan", Role: Driver})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "2", OwnerID: "2", Model: "XUV", Capacity: 7})
+	_ = rideMgr.OfferRide(Ride{ID: "1", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4})
+	_ = rideMgr.OfferRide(Ride{ID: "2", DriverID: "2", VehicleID: "2", Source: "B", Destination: "C", AvailableSeats: 4})
+
+	booking, err := rideMgr.SelectRide("3", "A", "C", 2, string(MostVacantSeats))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := rideMgr.CancelRide("2", "flat tyre"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	cancelled, _ := rideMgr.GetBookingByID(booking.ID)
+	if cancelled.Status != BookingCancelled {
+		t.Fatalf("Expected booking to be cancelled, but got %v", cancelled.Status)
+	}
+	ride, _ := rideStorage.GetRideByID("1")
+	if ride.AvailableSeats != 4 {
+		t.Fatalf("Expected seats on ride 1 to be returned, but got %d", ride.AvailableSeats)
+	}
+	cancelledRide, _ := rideStorage.GetRideByID("2")
+	if cancelledRide.Status != RideCancelled {
+		t.Fatalf("Expected ride 2 to be cancelled, but got %v", cancelledRide.Status)
+	}
+}
+
+// Test that a booked ride cannot be ended without having been started
+func TestEndUnstartedRideWithBookings(t *testing.T) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+
+	_ = userMgr.AddUser(User{ID: "1", Name: "Amar", Role: Driver})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4})
+	_ = rideMgr.OfferRide(Ride{ID: "1", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4})
+
+	if _, err := rideMgr.SelectRide("3", "A", "B", 1, string(MostVacantSeats)); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := rideMgr.EndRide("1"); err == nil {
+		t.Fatalf("Expected error ending a booked ride that never started")
+	}
+	if ride, _ := rideStorage.GetRideByID("1"); ride.Status != RideOffered {
+		t.Fatalf("Expected ride to still be %v, but got %v", RideOffered, ride.Status)
+	}
+	if err := rideMgr.StartRide("1"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := rideMgr.EndRide("1"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+}
+
+// Test that seats reserved on a ride cancelled before the booking is recorded
+// don't become a booking
+func TestBookingCancelledRide(t *testing.T) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+
+	_ = userMgr.AddUser(User{ID: "1", Name: "Amar", Role: Driver})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4})
+	_ = rideMgr.OfferRide(Ride{ID: "1", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4})
+
+	ride, _ := rideStorage.GetRideByID("1")
+	if err := rideMgr.CancelRide("1", "flat tyre"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	it := Itinerary{Seats: 1, Legs: []ItineraryLeg{{Ride: ride, Fare: 100}}}
+	if _, err := rideMgr.createBooking("3", []Ride{ride}, it); err == nil {
+		t.Fatalf("Expected error booking a cancelled ride")
+	}
+	if bookings := rideMgr.GetBookingsByRide("1"); len(bookings) != 0 {
+		t.Fatalf("Expected no bookings on the cancelled ride, but got %d", len(bookings))
+	}
+}
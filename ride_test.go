@@ -1,7 +1,12 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 // Test offering a ride
@@ -12,7 +17,7 @@ func TestOfferRide(t *testing.T) {
 
 	userMgr := NewUserManager(userStorage)
 	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
-	rideMgr := NewRideManager(rideStorage, userMgr, vehicleMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
 
 	user := User{ID: "1", Name: "Amar", Role: "Driver"}
 	vehicle := Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4}
@@ -28,7 +33,8 @@ func TestOfferRide(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Expected to retrieve ride, but got error %v", err)
 	}
-	if retrievedRide != ride {
+	ride.Status = RideOffered
+	if !reflect.DeepEqual(retrievedRide, ride) {
 		t.Fatalf("Expected ride to be %v, but got %v", ride, retrievedRide)
 	}
 }
@@ -41,7 +47,7 @@ func TestSelectRide(t *testing.T) {
 
 	userMgr := NewUserManager(userStorage)
 	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
-	rideMgr := NewRideManager(rideStorage, userMgr, vehicleMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
 
 	user := User{ID: "1", Name: "Amar", Role: "Driver"}
 	vehicle := Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4}
@@ -56,12 +62,12 @@ func TestSelectRide(t *testing.T) {
 		t.Fatalf("Expected no error, but got %v", err)
 	}
 
-	if selectedRoute[0].ID != ride.ID {
-		t.Fatalf("Expected selected ride ID to be %v, but got %v", ride.ID, selectedRoute[0].ID)
+	if selectedRoute.Legs[0].ID != ride.ID {
+		t.Fatalf("Expected selected ride ID to be %v, but got %v", ride.ID, selectedRoute.Legs[0].ID)
 	}
 
-	if selectedRoute[0].AvailableSeats != 2 {
-		t.Fatalf("Expected available seats to be 2, but got %v", selectedRoute[0].AvailableSeats)
+	if selectedRoute.Legs[0].AvailableSeats != 2 {
+		t.Fatalf("Expected available seats to be 2, but got %v", selectedRoute.Legs[0].AvailableSeats)
 	}
 }
 
@@ -73,7 +79,7 @@ func TestEndRide(t *testing.T) {
 
 	userMgr := NewUserManager(userStorage)
 	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
-	rideMgr := NewRideManager(rideStorage, userMgr, vehicleMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
 
 	user := User{ID: "1", Name: "Amar", Role: "Driver"}
 	vehicle := Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4}
@@ -86,8 +92,12 @@ func TestEndRide(t *testing.T) {
 		t.Fatalf("Expected no error, but got %v", err)
 	}
 
-	if _, err := rideStorage.GetRideByID(ride.ID); err == nil {
-		t.Fatalf("Expected ride to be deleted, but it still exists")
+	retrievedRide, err := rideStorage.GetRideByID(ride.ID)
+	if err != nil {
+		t.Fatalf("Expected ended ride to be kept as history, but got error %v", err)
+	}
+	if retrievedRide.Status != RideCompleted {
+		t.Fatalf("Expected ride to be %v, but got %v", RideCompleted, retrievedRide.Status)
 	}
 }
 
@@ -101,7 +111,7 @@ func TestFindMultipleRidesForMultipleSegments(t *testing.T) {
 	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
 
 	// Create a ride manager
-	rideMgr := NewRideManager(rideStorage, userMgr, vehicleMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
 	_ = userMgr.AddUser(User{ID: "1", Name: "Amar1", Role: "Driver"})
 	_ = userMgr.AddUser(User{ID: "2", Name: "Amar2", Role: "Driver"})
 	_ = userMgr.AddUser(User{ID: "3", Name: "Amar3", Role: "Driver"})
@@ -134,7 +144,7 @@ func TestFindMultipleRidesForMultipleSegments(t *testing.T) {
 	}
 
 	maxSeatAvail := 999
-	for _, route := range selectedRoutes {
+	for _, route := range selectedRoutes.Legs {
 		if maxSeatAvail > route.AvailableSeats {
 			maxSeatAvail = route.AvailableSeats
 		}
@@ -146,3 +156,351 @@ func TestFindMultipleRidesForMultipleSegments(t *testing.T) {
 		t.Fatalf("Expected %d rides available for the route, but got %d", expectedRideCount, maxSeatAvail)
 	}
 }
+
+// Test OfferRide, SelectRide, StartRide and EndRide from many goroutines; run with -race
+func TestConcurrentRideOperations(t *testing.T) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+
+	const drivers = 20
+	for i := 0; i < drivers; i++ {
+		id := fmt.Sprint(i)
+		_ = userMgr.AddUser(User{ID: id, Name: "Driver" + id, Role: Driver})
+		_ = vehicleMgr.AddVehicle(Vehicle{ID: id, OwnerID: id, Model: "XUV", Capacity: 7})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < drivers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprint(i)
+			for round := 0; round < 10; round++ {
+				rideID := fmt.Sprintf("%d-%d", i, round)
+				if err := rideMgr.OfferRide(Ride{ID: rideID, DriverID: id, VehicleID: id, Source: "A", Destination: "B", AvailableSeats: 4}); err != nil {
+					t.Errorf("Expected no error, but got %v", err)
+					return
+				}
+				_ = rideMgr.StartRide(rideID)
+				_ = rideMgr.EndRide(rideID)
+			}
+		}(i)
+	}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for round := 0; round < 10; round++ {
+				_, _ = rideMgr.SelectRide(fmt.Sprintf("p%d", i), "A", "B", 1, string(MostVacantSeats))
+				_ = rideStorage.GetAllRides()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, ride := range rideStorage.GetAllRides() {
+		if ride.Status != RideCompleted {
+			t.Fatalf("Expected all rides to be completed, but ride %s is %v", ride.ID, ride.Status)
+		}
+	}
+}
+
+// Test that concurrent offers for the same driver admit exactly one ride
+func TestConcurrentOfferRideSameDriver(t *testing.T) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+
+	_ = userMgr.AddUser(User{ID: "1", Name: "Amar", Role: Driver})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_ = rideMgr.OfferRide(Ride{ID: fmt.Sprint(i), DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4})
+		}(i)
+	}
+	wg.Wait()
+
+	if rides := rideStorage.GetAllRides(); len(rides) != 1 {
+		t.Fatalf("Expected exactly 1 ride, but got %d", len(rides))
+	}
+}
+
+// Test that concurrent bookings never oversell a ride
+func TestConcurrentSelectRideNoOverbooking(t *testing.T) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+
+	_ = userMgr.AddUser(User{ID: "1", Name: "Amar", Role: Driver})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4})
+	_ = rideMgr.OfferRide(Ride{ID: "1", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4})
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		booked int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := rideMgr.SelectRide(fmt.Sprintf("p%d", i), "A", "B", 1, string(MostVacantSeats)); err == nil {
+				mu.Lock()
+				booked++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if booked != 4 {
+		t.Fatalf("Expected 4 bookings, but got %d", booked)
+	}
+	ride, _ := rideStorage.GetRideByID("1")
+	if ride.AvailableSeats != 0 {
+		t.Fatalf("Expected 0 available seats, but got %d", ride.AvailableSeats)
+	}
+}
+
+// Test that a stale version is rejected by CompareAndUpdateRide
+func TestCompareAndUpdateRideConflict(t *testing.T) {
+	rideStorage := NewInMemoryRideStorage()
+	_ = rideStorage.AddRide(Ride{ID: "1", AvailableSeats: 2})
+
+	stale, _ := rideStorage.GetRideByID("1")
+	fresh := stale
+	fresh.AvailableSeats = 1
+	if err := rideStorage.CompareAndUpdateRide(fresh); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	stale.AvailableSeats = 0
+	if err := rideStorage.CompareAndUpdateRide(stale); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("Expected ErrVersionConflict, but got %v", err)
+	}
+}
+
+// Test that reserving more seats than remain returns a typed error
+func TestReserveSeatsUnavailable(t *testing.T) {
+	rideStorage := NewInMemoryRideStorage()
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), nil, nil)
+	_ = rideStorage.AddRide(Ride{ID: "1", AvailableSeats: 1, Status: RideOffered})
+
+	_, err := rideMgr.reserveSeats(Ride{ID: "1"}, 2)
+	var seatsErr *SeatsUnavailableError
+	if !errors.As(err, &seatsErr) {
+		t.Fatalf("Expected SeatsUnavailableError, but got %v", err)
+	}
+	if seatsErr.Available != 1 || seatsErr.Requested != 2 {
+		t.Fatalf("Expected requested 2 and available 1, but got %+v", seatsErr)
+	}
+}
+
+// failingRideStorage fails conditional updates for one ride
+type failingRideStorage struct {
+	RideStorage
+	failRideID string
+}
+
+func (s *failingRideStorage) CompareAndUpdateRide(ride Ride) error {
+	if ride.ID == s.failRideID {
+		return fmt.Errorf("disk full")
+	}
+	return s.RideStorage.CompareAndUpdateRide(ride)
+}
+
+// Test that a failing leg rolls back the legs already reserved
+func TestIndirectRouteRollsBackOnLegFailure(t *testing.T) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := &failingRideStorage{RideStorage: NewInMemoryRideStorage(), failRideID: "2"}
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+
+	_ = userMgr.AddUser(User{ID: "1", Name: "Amar", Role: Driver})
+	_ = userMgr.AddUser(User{ID: "2", Name: "Chetan", Role: Driver})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "2", OwnerID: "2", Model: "XUV", Capacity: 7})
+	_ = rideMgr.OfferRide(Ride{ID: "1", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4})
+	_ = rideMgr.OfferRide(Ride{ID: "2", DriverID: "2", VehicleID: "2", Source: "B", Destination: "C", AvailableSeats: 4})
+
+	_, err := rideMgr.SelectRide("3", "A", "C", 2, string(MostVacantSeats))
+	var legErr *LegBookingError
+	if !errors.As(err, &legErr) {
+		t.Fatalf("Expected LegBookingError, but got %v", err)
+	}
+	if legErr.Leg != 2 || legErr.Ride.ID != "2" {
+		t.Fatalf("Expected leg 2 (ride 2) to fail, but got leg %d (ride %s)", legErr.Leg, legErr.Ride.ID)
+	}
+
+	ride, _ := rideStorage.GetRideByID("1")
+	if ride.AvailableSeats != 4 {
+		t.Fatalf("Expected seats on leg 1 to be released, but got %d", ride.AvailableSeats)
+	}
+	if taken := rideMgr.rideStats["3"].taken; taken != 0 {
+		t.Fatalf("Expected no rides taken, but got %d", taken)
+	}
+}
+
+// Test that a successful indirect route reserves seats on every leg
+func TestIndirectRouteReturnsReservedRides(t *testing.T) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+
+	_ = userMgr.AddUser(User{ID: "1", Name: "Amar", Role: Driver})
+	_ = userMgr.AddUser(User{ID: "2", Name: "Chetan", Role: Driver})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "2", OwnerID: "2", Model: "XUV", Capacity: 7})
+	_ = rideMgr.OfferRide(Ride{ID: "1", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4})
+	_ = rideMgr.OfferRide(Ride{ID: "2", DriverID: "2", VehicleID: "2", Source: "B", Destination: "C", AvailableSeats: 4})
+
+	route, err := rideMgr.SelectRide("3", "A", "C", 3, string(MostVacantSeats))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(route.Legs) != 2 {
+		t.Fatalf("Expected 2 legs, but got %d", len(route.Legs))
+	}
+	for _, leg := range route.Legs {
+		stored, _ := rideStorage.GetRideByID(leg.ID)
+		if stored.AvailableSeats != 1 {
+			t.Fatalf("Expected 1 seat left on ride %s, but got %d", leg.ID, stored.AvailableSeats)
+		}
+	}
+	if taken := rideMgr.rideStats["3"].taken; taken != 2 {
+		t.Fatalf("Expected 2 rides taken, but got %d", taken)
+	}
+}
+
+// Test that a driver may offer non-overlapping scheduled rides only
+func TestOfferScheduledRides(t *testing.T) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	rideMgr.now = func() time.Time { return now }
+
+	_ = userMgr.AddUser(User{ID: "1", Name: "Amar", Role: Driver})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4})
+
+	morning := Ride{ID: "1", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4,
+		DepartureTime: now.Add(time.Hour), ArrivalTime: now.Add(2 * time.Hour)}
+	if err := rideMgr.OfferRide(morning); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	overlapping := Ride{ID: "2", DriverID: "1", VehicleID: "1", Source: "B", Destination: "A", AvailableSeats: 4,
+		DepartureTime: now.Add(90 * time.Minute), ArrivalTime: now.Add(3 * time.Hour)}
+	if err := rideMgr.OfferRide(overlapping); err == nil {
+		t.Fatalf("Expected error offering an overlapping ride")
+	}
+	evening := Ride{ID: "3", DriverID: "1", VehicleID: "1", Source: "B", Destination: "A", AvailableSeats: 4,
+		DepartureTime: now.Add(10 * time.Hour), ArrivalTime: now.Add(11 * time.Hour)}
+	if err := rideMgr.OfferRide(evening); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	past := Ride{ID: "4", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4,
+		DepartureTime: now.Add(-2 * time.Hour), ArrivalTime: now.Add(-time.Hour)}
+	if err := rideMgr.OfferRide(past); err == nil {
+		t.Fatalf("Expected error offering a ride in the past")
+	}
+	backwards := Ride{ID: "5", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4,
+		DepartureTime: now.Add(20 * time.Hour), ArrivalTime: now.Add(19 * time.Hour)}
+	if err := rideMgr.OfferRide(backwards); err == nil {
+		t.Fatalf("Expected error offering a ride that arrives before it departs")
+	}
+}
+
+// Test that SelectRideInWindow only books rides departing in the window
+func TestSelectRideInWindow(t *testing.T) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	rideMgr.now = func() time.Time { return now }
+
+	_ = userMgr.AddUser(User{ID: "1", Name: "Amar", Role: Driver})
+	_ = userMgr.AddUser(User{ID: "2", Name: "Chetan", Role: Driver})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "2", OwnerID: "2", Model: "XUV", Capacity: 7})
+	_ = rideMgr.OfferRide(Ride{ID: "today", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 2,
+		DepartureTime: now.Add(time.Hour), ArrivalTime: now.Add(2 * time.Hour)})
+	_ = rideMgr.OfferRide(Ride{ID: "tomorrow", DriverID: "2", VehicleID: "2", Source: "A", Destination: "B", AvailableSeats: 6,
+		DepartureTime: now.Add(25 * time.Hour), ArrivalTime: now.Add(26 * time.Hour)})
+
+	window := TimeWindow{From: now.Add(30 * time.Minute), To: now.Add(90 * time.Minute)}
+	booking, err := rideMgr.SelectRideInWindow("3", "A", "B", 1, string(MostVacantSeats), window)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if booking.Legs[0].ID != "today" {
+		t.Fatalf("Expected the ride departing in the window, but got %s", booking.Legs[0].ID)
+	}
+
+	late := TimeWindow{From: now.Add(3 * time.Hour), To: now.Add(4 * time.Hour)}
+	if _, err := rideMgr.SelectRideInWindow("3", "A", "B", 1, string(MostVacantSeats), late); err == nil {
+		t.Fatalf("Expected error when no ride departs in the window")
+	}
+}
+
+// Test that ride statistics are rebuilt from the rides and bookings in storage
+func TestRideStatsFromStorage(t *testing.T) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+	bookingStorage := NewInMemoryBookingStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, bookingStorage, userMgr, vehicleMgr)
+
+	_ = userMgr.AddUser(User{ID: "1", Name: "Amar", Role: Driver})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "Toyota", Capacity: 4})
+	_ = rideMgr.OfferRide(Ride{ID: "1", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4})
+	kept, _ := rideMgr.SelectRide("2", "A", "B", 1, string(MostVacantSeats))
+	cancelled, _ := rideMgr.SelectRide("3", "A", "B", 1, string(MostVacantSeats))
+	_ = rideMgr.CancelBooking(cancelled.ID, "change of plans")
+	_ = rideMgr.StartRide("1")
+	_ = rideMgr.EndRide("1")
+
+	reopened := NewRideManager(rideStorage, bookingStorage, userMgr, vehicleMgr)
+	if offered := reopened.rideStats["1"].offered; offered != 1 {
+		t.Fatalf("Expected 1 ride offered, but got %d", offered)
+	}
+	if taken := reopened.rideStats[kept.PassengerID].taken; taken != 1 {
+		t.Fatalf("Expected 1 ride taken, but got %d", taken)
+	}
+	if taken := reopened.rideStats["3"].taken; taken != 0 {
+		t.Fatalf("Expected no rides taken after cancelling, but got %d", taken)
+	}
+}
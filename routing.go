@@ -0,0 +1,261 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type RouteObjective string
+
+const (
+	FewestTransfers  RouteObjective = "Fewest Transfers"
+	ShortestDuration RouteObjective = "Shortest Duration"
+	LowestFare       RouteObjective = "Lowest Fare"
+)
+
+// maxRouteAttempts bounds how often SelectRide quotes again after a
+// concurrent booking takes the seats on the option it picked.
+const maxRouteAttempts = 3
+
+// RouteOptions selects the cost a route is optimised for and filters the rides
+// it may use.
+type RouteOptions struct {
+	Objective RouteObjective
+	Vehicle   VehiclePreference // applied to every leg
+	Window    TimeWindow        // departure window for the first leg
+}
+
+// SetRouteObjective sets the cost SelectRide optimises indirect routes for.
+func (rm *rideManager) SetRouteObjective(objective RouteObjective) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.routeObjective = objective
+}
+
+// SetFareFunc sets the per-seat fare of a leg, used by the LowestFare
+// objective, the Lowest Fare strategy and itinerary prices. Until one is set
+// every leg not priced by its driver is free.
+func (rm *rideManager) SetFareFunc(fare func(Ride) float64) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.fareFunc = fare
+}
+
+// routeLabel is a partial route on the Dijkstra frontier.
+type routeLabel struct {
+	cost float64
+	legs []Ride
+	key  string // leg keys joined, for deterministic tie-breaking
+}
+
+// legKey identifies a leg: a ride ID, plus the stops boarded and alighted at
+// when the leg is only part of the ride.
+func legKey(leg Ride) string {
+	if leg.SegmentSeats == nil && len(leg.Stops) == 0 {
+		return leg.ID
+	}
+	return leg.ID + "\x01" + leg.Source + "\x01" + leg.Destination
+}
+
+// rides reports whether the route already uses ride rideID.
+func (l *routeLabel) rides(rideID string) bool {
+	for _, leg := range l.legs {
+		if leg.ID == rideID {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *routeLabel) last() Ride {
+	return l.legs[len(l.legs)-1]
+}
+
+func (l *routeLabel) visits(place string) bool {
+	if l.legs[0].Source == place {
+		return true
+	}
+	for _, leg := range l.legs {
+		if leg.Destination == place {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *routeLabel) extend(cost float64, next Ride) *routeLabel {
+	legs := make([]Ride, len(l.legs), len(l.legs)+1)
+	copy(legs, l.legs)
+	return &routeLabel{cost: l.cost + cost, legs: append(legs, next), key: l.key + "\x00" + legKey(next)}
+}
+
+// routeQueue orders labels by cost, then fewer legs, then earlier arrival,
+// then ride IDs, so equal-cost searches always return the same route.
+type routeQueue []*routeLabel
+
+func (q routeQueue) Len() int { return len(q) }
+func (q routeQueue) Less(i, j int) bool {
+	a, b := q[i], q[j]
+	if a.cost != b.cost {
+		return a.cost < b.cost
+	}
+	if len(a.legs) != len(b.legs) {
+		return len(a.legs) < len(b.legs)
+	}
+	if !a.last().ArrivalTime.Equal(b.last().ArrivalTime) {
+		return a.last().ArrivalTime.Before(b.last().ArrivalTime)
+	}
+	return strings.Compare(a.key, b.key) < 0
+}
+func (q routeQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *routeQueue) Push(x any)   { *q = append(*q, x.(*routeLabel)) }
+func (q *routeQueue) Pop() any {
+	old := *q
+	label := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return label
+}
+
+// FindRoute returns the cheapest chain of rides from source to destination
+// with seats free on every leg. It only reads storage; nothing is reserved.
+func (rm *rideManager) FindRoute(source, destination string, seats int, opts RouteOptions) ([]Ride, error) {
+	routes, err := rm.findRoutes(source, destination, seats, 1, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("no rides available for the route")
+	}
+	return routes[0].legs, nil
+}
+
+// findRoutes returns up to k routes from source to destination, cheapest
+// first. Legs may be any part of a ride, and need seats free only on the
+// segments they cover. Each ride may be left at each place by at most k
+// partial routes, which is enough to find the k best routes that never
+// revisit a place.
+func (rm *rideManager) findRoutes(source, destination string, seats, k int, opts RouteOptions) ([]*routeLabel, error) {
+	rm.mu.Lock()
+	layovers, fare := rm.layovers, rm.fareFunc
+	rm.mu.Unlock()
+	if opts.Objective == "" {
+		opts.Objective = FewestTransfers
+	}
+
+	legCost := func(prev *Ride, next Ride) (float64, error) {
+		switch opts.Objective {
+		case FewestTransfers:
+			return 1, nil
+		case ShortestDuration:
+			// Measured to the arrival of each leg so the total is the time
+			// from the first departure to the final arrival.
+			if prev != nil && prev.IsScheduled() && next.IsScheduled() {
+				return float64(next.ArrivalTime.Sub(prev.ArrivalTime)), nil
+			}
+			if next.IsScheduled() {
+				return float64(next.ArrivalTime.Sub(next.DepartureTime)), nil
+			}
+			return 0, nil
+		case LowestFare:
+			return rm.legFare(next, seats, fare, 1), nil
+		default:
+			return 0, fmt.Errorf("unknown route objective %q", opts.Objective)
+		}
+	}
+
+	// Group the bookable legs by where they board once instead of querying
+	// per expansion. Every part of a multi-stop ride with enough seats on
+	// each segment it covers is a leg of its own.
+	bySource := make(map[string][]Ride)
+	for _, status := range bookableStatuses {
+		for _, ride := range rm.storage.GetRidesByStatus(status) {
+			if !rm.isPreferredVehicle(ride.VehicleID, opts.Vehicle) {
+				continue
+			}
+			for _, key := range routeKeys(ride) {
+				if leg, _ := ride.Segment(key.source, key.destination); leg.AvailableSeats >= seats {
+					bySource[leg.Source] = append(bySource[leg.Source], leg)
+				}
+			}
+		}
+	}
+	for _, legs := range bySource {
+		sort.Slice(legs, func(i, j int) bool { return legKey(legs[i]) < legKey(legs[j]) })
+	}
+
+	// A route may start and end at any place within walking distance; the
+	// transfers in between are at the same place.
+	sources, destinations := rm.walkable(source), rm.walkable(destination)
+	queue := &routeQueue{}
+	for place := range sources {
+		for _, ride := range bySource[place] {
+			if !opts.Window.Admits(ride) {
+				continue
+			}
+			cost, err := legCost(nil, ride)
+			if err != nil {
+				return nil, err
+			}
+			heap.Push(queue, &routeLabel{cost: cost, legs: []Ride{ride}, key: legKey(ride)})
+		}
+	}
+
+	// A search node is a ride and the place left it at, which fixes the
+	// arrival time every later leg must connect with.
+	node := func(leg Ride) string { return leg.ID + "\x00" + leg.Destination }
+	var routes []*routeLabel
+	settled := make(map[string]int)
+	for queue.Len() > 0 && len(routes) < k {
+		label := heap.Pop(queue).(*routeLabel)
+		last := label.last()
+		if settled[node(last)] >= k {
+			continue
+		}
+		settled[node(last)]++
+		if destinations[last.Destination] {
+			routes = append(routes, label)
+			continue
+		}
+		for _, next := range bySource[last.Destination] {
+			if settled[node(next)] >= k || label.rides(next.ID) || label.visits(next.Destination) || !layovers.connects(last, next) {
+				continue
+			}
+			cost, err := legCost(&last, next)
+			if err != nil {
+				return nil, err
+			}
+			heap.Push(queue, label.extend(cost, next))
+		}
+	}
+	return routes, nil
+}
+
+// reserveLegs reserves seats on every leg in order and returns the rides as
+// updated. If a leg fails, the legs already reserved are released and a
+// *LegBookingError names the failed leg.
+func (rm *rideManager) reserveLegs(userID string, legs []Ride, seats int) ([]Ride, error) {
+	reserved := make([]Ride, 0, len(legs))
+	for i, leg := range legs {
+		ride, err := rm.reserveSeats(leg, seats)
+		if err != nil {
+			legErr := &LegBookingError{Leg: i + 1, Ride: leg, Err: err}
+			if rbErr := rm.rollbackLegs(userID, legs[:i], seats); rbErr != nil {
+				return nil, fmt.Errorf("%w; rollback failed: %v", legErr, rbErr)
+			}
+			return nil, legErr
+		}
+		reserved = append(reserved, ride)
+		rm.incrementTakenStats(userID)
+	}
+	return reserved, nil
+}
+
+// isSeatsUnavailable reports whether err is a lost race for seats, after
+// which searching again may find another route.
+func isSeatsUnavailable(err error) bool {
+	var seatsErr *SeatsUnavailableError
+	return errors.As(err, &seatsErr)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newRoutingFixture offers A->B->C->D (fast, three legs) and A->E->D (slow,
+// two legs) with one driver and vehicle per ride.
+func newRoutingFixture(t *testing.T) (*rideManager, RideStorage) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	rideMgr.now = func() time.Time { return now }
+
+	at := func(minutes int) time.Time { return now.Add(time.Duration(minutes) * time.Minute) }
+	rides := []Ride{
+		{ID: "AB", Source: "A", Destination: "B", DepartureTime: at(60), ArrivalTime: at(80)},
+		{ID: "BC", Source: "B", Destination: "C", DepartureTime: at(90), ArrivalTime: at(110)},
+		{ID: "CD", Source: "C", Destination: "D", DepartureTime: at(120), ArrivalTime: at(140)},
+		{ID: "AE", Source: "A", Destination: "E", DepartureTime: at(60), ArrivalTime: at(180)},
+		{ID: "ED", Source: "E", Destination: "D", DepartureTime: at(190), ArrivalTime: at(300)},
+	}
+	for _, ride := range rides {
+		_ = userMgr.AddUser(User{ID: ride.ID, Name: "Driver" + ride.ID, Role: Driver})
+		_ = vehicleMgr.AddVehicle(Vehicle{ID: ride.ID, OwnerID: ride.ID, Model: "XUV", Capacity: 7})
+		ride.DriverID, ride.VehicleID, ride.AvailableSeats = ride.ID, ride.ID, 4
+		if err := rideMgr.OfferRide(ride); err != nil {
+			t.Fatalf("Error offering ride: %v", err)
+		}
+	}
+	return rideMgr, rideStorage
+}
+
+func routeIDs(legs []Ride) []string {
+	return Booking{Legs: legs}.RideIDs()
+}
+
+// Test that each objective picks its own optimal route
+func TestFindRouteObjectives(t *testing.T) {
+	rideMgr, _ := newRoutingFixture(t)
+
+	tests := []struct {
+		objective RouteObjective
+		fare      func(Ride) float64
+		expected  string
+	}{
+		{objective: FewestTransfers, expected: "[AE ED]"},
+		{objective: ShortestDuration, expected: "[AB BC CD]"},
+		{objective: LowestFare, fare: func(r Ride) float64 {
+			if r.ID == "AE" {
+				return 50
+			}
+			return 10
+		}, expected: "[AB BC CD]"},
+	}
+	for _, tt := range tests {
+		rideMgr.SetFareFunc(tt.fare)
+		legs, err := rideMgr.FindRoute("A", "D", 1, RouteOptions{Objective: tt.objective})
+		if err != nil {
+			t.Fatalf("%s: expected no error, but got %v", tt.objective, err)
+		}
+		if got := fmt.Sprint(routeIDs(legs)); got != tt.expected {
+			t.Fatalf("%s: expected route %s, but got %s", tt.objective, tt.expected, got)
+		}
+	}
+}
+
+// Test that equal-cost routes are always broken the same way and nothing is reserved
+func TestFindRouteDeterministic(t *testing.T) {
+	rideMgr, rideStorage := newRoutingFixture(t)
+	rideMgr.SetFareFunc(nil)
+
+	for i := 0; i < 20; i++ {
+		// Every route is free, so the one with fewer legs wins the tie.
+		legs, err := rideMgr.FindRoute("A", "D", 1, RouteOptions{Objective: LowestFare})
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if got := fmt.Sprint(routeIDs(legs)); got != "[AE ED]" {
+			t.Fatalf("Expected route [AE ED], but got %s", got)
+		}
+	}
+	for _, ride := range rideStorage.GetAllRides() {
+		if ride.AvailableSeats != 4 {
+			t.Fatalf("Expected FindRoute not to reserve seats, but ride %s has %d", ride.ID, ride.AvailableSeats)
+		}
+	}
+}
+
+// Test that SelectRide books the route chosen by the configured objective
+func TestSelectRideUsesRouteObjective(t *testing.T) {
+	rideMgr, _ := newRoutingFixture(t)
+	rideMgr.SetRouteObjective(ShortestDuration)
+
+	booking, err := rideMgr.SelectRide("p1", "A", "D", 2, string(MostVacantSeats))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if got := fmt.Sprint(booking.RideIDs()); got != "[AB BC CD]" {
+		t.Fatalf("Expected route [AB BC CD], but got %s", got)
+	}
+	if booking.JourneyTime != 80*time.Minute {
+		t.Fatalf("Expected a journey time of 1h20m, but got %v", booking.JourneyTime)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// gridCellDegrees is the side of a spatial index cell, about 2.2 km of
+// latitude.
+const gridCellDegrees = 0.02
+
+// metresPerDegree is the length of one degree of latitude.
+const metresPerDegree = earthRadius * math.Pi / 180
+
+// lonCells is the number of cells around a line of latitude.
+var lonCells = int(math.Round(360 / gridCellDegrees))
+
+type gridCell struct {
+	lat, lon int
+}
+
+// cellOf returns the cell holding a point, wrapping longitudes past the
+// antimeridian.
+func cellOf(lat, lon float64) gridCell {
+	col := int(math.Floor((lon+180)/gridCellDegrees)) % lonCells
+	if col < 0 {
+		col += lonCells
+	}
+	return gridCell{lat: int(math.Floor((lat + 90) / gridCellDegrees)), lon: col}
+}
+
+// rideGrid indexes rides by the grid cell of their source location so a
+// radius query only visits the cells the circle overlaps. Rides without a
+// source location are not indexed. It is not safe for concurrent use; ride
+// storages guard it with their own lock.
+type rideGrid struct {
+	cells map[gridCell]map[string]Location // ride ID -> source location
+}
+
+func newRideGrid() *rideGrid {
+	return &rideGrid{cells: make(map[gridCell]map[string]Location)}
+}
+
+func (g *rideGrid) add(ride Ride) {
+	if ride.SourceLocation.Name == "" {
+		return
+	}
+	loc := ride.SourceLocation
+	cell := cellOf(loc.Lat, loc.Lon)
+	if g.cells[cell] == nil {
+		g.cells[cell] = make(map[string]Location)
+	}
+	g.cells[cell][ride.ID] = loc
+}
+
+func (g *rideGrid) remove(ride Ride) {
+	if ride.SourceLocation.Name == "" {
+		return
+	}
+	loc := ride.SourceLocation
+	cell := cellOf(loc.Lat, loc.Lon)
+	delete(g.cells[cell], ride.ID)
+	if len(g.cells[cell]) == 0 {
+		delete(g.cells, cell)
+	}
+}
+
+// near returns the IDs of rides whose source is within radius metres of
+// center, nearest first.
+func (g *rideGrid) near(center Location, radius float64) []string {
+	type hit struct {
+		id       string
+		distance float64
+	}
+	var hits []hit
+	visit := func(rides map[string]Location) {
+		for id, loc := range rides {
+			if d := center.DistanceTo(loc); d <= radius {
+				hits = append(hits, hit{id, d})
+			}
+		}
+	}
+
+	for _, cell := range g.cellsNear(center, radius) {
+		visit(g.cells[cell])
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].distance != hits[j].distance {
+			return hits[i].distance < hits[j].distance
+		}
+		return hits[i].id < hits[j].id
+	})
+	ids := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i] = h.id
+	}
+	return ids
+}
+
+// cellsNear returns the occupied cells that may hold points within radius
+// metres of center, i.e. those in the circle's bounding box. When the box
+// spans more cells than are occupied, the occupied cells are checked against
+// it instead of visiting every cell in it.
+func (g *rideGrid) cellsNear(center Location, radius float64) []gridCell {
+	latSpan := radius / metresPerDegree
+	minLat, maxLat := math.Max(center.Lat-latSpan, -90), math.Min(center.Lat+latSpan, 90)
+	low, high := cellOf(minLat, 0).lat, cellOf(maxLat, 0).lat
+
+	// A box reaching a pole, or wider than half the globe, takes in every
+	// longitude.
+	firstCol, cols := 0, lonCells
+	if minLat > -90 && maxLat < 90 {
+		// Degrees of longitude are shortest at the edge of the box furthest
+		// from the equator, so that edge bounds the longitude span.
+		lonSpan := latSpan / math.Cos(math.Max(math.Abs(minLat), math.Abs(maxLat))*math.Pi/180)
+		if lonSpan < 180 {
+			firstCol = cellOf(0, center.Lon-lonSpan).lon
+			cols = (cellOf(0, center.Lon+lonSpan).lon-firstCol+lonCells)%lonCells + 1
+		}
+	}
+	inBox := func(cell gridCell) bool {
+		return cell.lat >= low && cell.lat <= high && (cell.lon-firstCol+lonCells)%lonCells < cols
+	}
+
+	var cells []gridCell
+	if (high-low+1)*cols > len(g.cells) {
+		for cell := range g.cells {
+			if inBox(cell) {
+				cells = append(cells, cell)
+			}
+		}
+		return cells
+	}
+	for lat := low; lat <= high; lat++ {
+		for i := 0; i < cols; i++ {
+			cell := gridCell{lat: lat, lon: (firstCol + i) % lonCells}
+			if _, ok := g.cells[cell]; ok {
+				cells = append(cells, cell)
+			}
+		}
+	}
+	return cells
+}
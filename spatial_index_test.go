@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// randomRides returns n rides with sources scattered over a box around
+// center.
+func randomRides(rng *rand.Rand, n int, center Location, spread float64) []Ride {
+	rides := make([]Ride, n)
+	for i := range rides {
+		loc := Location{
+			Name: fmt.Sprintf("P%d", i),
+			Lat:  center.Lat + (rng.Float64()*2-1)*spread,
+			Lon:  center.Lon + (rng.Float64()*2-1)*spread,
+		}
+		if loc.Lon > 180 {
+			loc.Lon -= 360
+		}
+		if loc.Lon < -180 {
+			loc.Lon += 360
+		}
+		rides[i] = Ride{ID: fmt.Sprintf("R%d", i), Source: loc.Name, Destination: "D", SourceLocation: loc}
+	}
+	return rides
+}
+
+// Test that the grid finds exactly the rides a linear scan does
+func TestRideGridMatchesLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name   string
+		center Location
+		spread float64
+		radius float64
+	}{
+		{name: "city", center: Location{Lat: 12.97, Lon: 77.59}, spread: 0.2, radius: 3000},
+		{name: "cell sized", center: Location{Lat: 12.97, Lon: 77.59}, spread: 0.2, radius: 500},
+		{name: "antimeridian", center: Location{Lat: -17.7, Lon: 179.99}, spread: 0.2, radius: 5000},
+		{name: "near pole", center: Location{Lat: 89.95, Lon: 10}, spread: 0.04, radius: 8000},
+		{name: "whole region", center: Location{Lat: 12.97, Lon: 77.59}, spread: 0.2, radius: 100000},
+	}
+	for _, tt := range tests {
+		storage := NewInMemoryRideStorage()
+		rides := randomRides(rng, 2000, tt.center, tt.spread)
+		for _, ride := range rides {
+			_ = storage.AddRide(ride)
+		}
+		_ = storage.AddRide(Ride{ID: "nowhere", Source: "X", Destination: "D"})
+
+		var expected []string
+		for _, ride := range rides {
+			if tt.center.DistanceTo(ride.SourceLocation) <= tt.radius {
+				expected = append(expected, ride.ID)
+			}
+		}
+		got := storage.GetRidesNear(tt.center, tt.radius)
+		if len(got) != len(expected) {
+			t.Fatalf("%s: expected %d rides, but got %d", tt.name, len(expected), len(got))
+		}
+		for i := 1; i < len(got); i++ {
+			if tt.center.DistanceTo(got[i].SourceLocation) < tt.center.DistanceTo(got[i-1].SourceLocation) {
+				t.Fatalf("%s: expected rides nearest first, but %s comes after %s", tt.name, got[i].ID, got[i-1].ID)
+			}
+		}
+	}
+}
+
+// Test that a query wider than the occupied cells only visits the cells near
+// it, not every ride in the index
+func TestRideGridSkipsFarCells(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	bangalore := Location{Lat: 12.97, Lon: 77.59}
+	delhi := Location{Lat: 28.61, Lon: 77.21}
+	grid := newRideGrid()
+	for _, ride := range append(randomRides(rng, 500, bangalore, 0.01), randomRides(rng, 500, delhi, 0.01)...) {
+		grid.add(ride)
+	}
+
+	cells := grid.cellsNear(bangalore, 20000)
+	if len(cells) == 0 {
+		t.Fatalf("Expected the cells around Bangalore, but got none")
+	}
+	// 20 km is well under a degree of latitude, so no cell may be a degree
+	// north of Bangalore.
+	north := cellOf(bangalore.Lat+1, bangalore.Lon).lat
+	for _, cell := range cells {
+		if cell.lat >= north {
+			t.Fatalf("Expected only cells near Bangalore, but got %+v", cell)
+		}
+	}
+}
+
+// Test that updates and deletes keep the index in step with the rides
+func TestRideGridFollowsUpdates(t *testing.T) {
+	home := Location{Name: "Home", Lat: 12.9716, Lon: 77.5946}
+	airport := Location{Name: "Airport", Lat: 13.1986, Lon: 77.7066}
+	dir := t.TempDir()
+	fileStorage, err := NewFileRideStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	for _, storage := range []RideStorage{NewInMemoryRideStorage(), fileStorage} {
+		ride := Ride{ID: "1", Source: "Home", Destination: "D", SourceLocation: home}
+		_ = storage.AddRide(ride)
+		if rides := storage.GetRidesNear(home, 100); len(rides) != 1 {
+			t.Fatalf("Expected 1 ride near Home, but got %d", len(rides))
+		}
+
+		ride.Source, ride.SourceLocation = "Airport", airport
+		if err := storage.UpdateRide(ride); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if rides := storage.GetRidesNear(home, 100); len(rides) != 0 {
+			t.Fatalf("Expected the moved ride to leave Home, but got %+v", rides)
+		}
+		rides := storage.GetRidesNear(airport, 100)
+		if len(rides) != 1 || rides[0].Version != 1 {
+			t.Fatalf("Expected the updated ride near Airport, but got %+v", rides)
+		}
+
+		_ = storage.AddRide(Ride{ID: "2", Source: "Home", Destination: "D", SourceLocation: home})
+		if err := storage.DeleteRide("1"); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if rides := storage.GetRidesNear(airport, 100); len(rides) != 0 {
+			t.Fatalf("Expected no rides after delete, but got %+v", rides)
+		}
+	}
+
+	fileStorage.Close()
+	reopened, err := NewFileRideStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	defer reopened.Close()
+	if rides := reopened.GetRidesNear(home, 100); len(rides) != 1 || rides[0].ID != "2" {
+		t.Fatalf("Expected the index to be rebuilt on reopen, but got %+v", rides)
+	}
+}
+
+// Test that rides offered from registered places can be found by coordinates
+func TestGetRidesNear(t *testing.T) {
+	rideMgr, _ := newPlacesFixture(t)
+
+	home := Location{Name: "pin", Lat: 12.9716, Lon: 77.5946}
+	rides := rideMgr.GetRidesNear(home, 1000, TimeWindow{})
+	if fmt.Sprint(routeIDs(rides)) != "[R1 R3]" {
+		t.Fatalf("Expected rides [R1 R3], but got %v", routeIDs(rides))
+	}
+	if rides[0].SourceLocation.Name != "HomeStop" {
+		t.Fatalf("Expected the ride to carry its source coordinates, but got %+v", rides[0].SourceLocation)
+	}
+	if rides := rideMgr.GetRidesNear(home, 100, TimeWindow{}); len(rides) != 0 {
+		t.Fatalf("Expected no rides within 100m, but got %v", routeIDs(rides))
+	}
+}
+
+func benchmarkRideStorage(b *testing.B, n int) (RideStorage, Location) {
+	center := Location{Lat: 12.97, Lon: 77.59}
+	storage := NewInMemoryRideStorage()
+	// About 100 km across, like a large city region.
+	for _, ride := range randomRides(rand.New(rand.NewSource(1)), n, center, 0.5) {
+		_ = storage.AddRide(ride)
+	}
+	return storage, center
+}
+
+// Benchmark a 2 km radius query against 100k rides using the grid index
+func BenchmarkGetRidesNear100k(b *testing.B) {
+	storage, center := benchmarkRideStorage(b, 100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		storage.GetRidesNear(center, 2000)
+	}
+}
+
+// Benchmark the same query as a linear scan over GetAllRides, for comparison
+func BenchmarkLinearScanNear100k(b *testing.B) {
+	storage, center := benchmarkRideStorage(b, 100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var near []Ride
+		for _, ride := range storage.GetAllRides() {
+			if center.DistanceTo(ride.SourceLocation) <= 2000 {
+				near = append(near, ride)
+			}
+		}
+	}
+}
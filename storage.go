@@ -1,5 +1,14 @@
 package main
 
+import "errors"
+
+// ErrVersionConflict is returned by CompareAndUpdateRide when the stored ride
+// has changed since the caller read it.
+var ErrVersionConflict = errors.New("ride was modified concurrently")
+
+// Implementations must be safe for concurrent use, and the GetAll* methods
+// return snapshots that callers may modify freely.
+
 // UserStorage defines methods for user storage
 type UserStorage interface {
 	AddUser(user User) error
@@ -14,11 +23,62 @@ type VehicleStorage interface {
 	GetAllVehicles() map[string]Vehicle
 }
 
+// PlaceStorage defines methods for place storage
+type PlaceStorage interface {
+	AddPlace(place Location) error
+	GetPlaceByName(name string) (Location, error)
+	GetAllPlaces() map[string]Location
+}
+
 // RideStorage defines methods for ride storage
 type RideStorage interface {
 	AddRide(ride Ride) error
 	GetRideByID(rideID string) (Ride, error)
 	UpdateRide(ride Ride) error
+	// CompareAndUpdateRide stores ride only if the stored version still equals
+	// ride.Version, otherwise it returns ErrVersionConflict. On success the
+	// stored ride has Version ride.Version+1.
+	CompareAndUpdateRide(ride Ride) error
 	DeleteRide(rideID string) error
 	GetAllRides() map[string]Ride
+	// The GetRidesBy* methods are answered from indexes kept in step with
+	// every write, and return rides ordered by ID. By source and by route
+	// consider every stop: GetRidesBySource finds the rides a passenger can
+	// board at source and GetRidesByRoute those they can ride from source to
+	// destination.
+	GetRidesByDriver(driverID string) []Ride
+	GetRidesByVehicle(vehicleID string) []Ride
+	GetRidesBySource(source string) []Ride
+	GetRidesByRoute(source, destination string) []Ride
+	GetRidesByStatus(status RideStatus) []Ride
+	// GetRidesNear returns the rides whose SourceLocation is within radius
+	// metres of center, nearest first. Rides without one are never returned.
+	GetRidesNear(center Location, radius float64) []Ride
+}
+
+// BookingStorage defines methods for booking storage
+type BookingStorage interface {
+	AddBooking(booking Booking) error
+	GetBookingByID(bookingID string) (Booking, error)
+	UpdateBooking(booking Booking) error
+	GetAllBookings() map[string]Booking
+	// The GetBookingsBy* methods are answered from indexes kept in step with
+	// every write, and return bookings ordered by ID. By ride finds the
+	// bookings with the ride among their legs.
+	GetBookingsByRide(rideID string) []Booking
+	GetBookingsByPassenger(passengerID string) []Booking
+}
+
+// LedgerStorage defines methods for ledger storage. Transactions are never
+// changed once added, and AddTransaction applies all of a transaction's
+// postings to the balances or none of them.
+type LedgerStorage interface {
+	AddTransaction(tx Transaction) error
+	GetTransactionByID(txID string) (Transaction, error)
+	// GetTransactionsByAccount returns the transactions posting to account
+	// in the order they were added.
+	GetTransactionsByAccount(account AccountID) []Transaction
+	TransactionCount() int
+	GetBalance(account AccountID) Money
+	GetAllBalances() map[AccountID]Money
 }
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SelectionRequest is what a strategy knows about the passenger's request.
+type SelectionRequest struct {
+	Seats int
+	Param string // text after "=" in the preference, e.g. the model in "Preferred Vehicle=Toyota"
+
+	Vehicle func(vehicleID string) (Vehicle, error)
+	Fare    func(Ride) float64 // per-seat fare; nil when no fares are configured
+}
+
+// RideSelectionStrategy picks one ride among direct candidates. Every
+// candidate already has enough seats, and candidates are ordered by ride ID.
+type RideSelectionStrategy interface {
+	Name() string
+	Select(rides []Ride, req SelectionRequest) (Ride, bool)
+}
+
+type strategyFunc struct {
+	name     string
+	selectFn func([]Ride, SelectionRequest) (Ride, bool)
+}
+
+func (s strategyFunc) Name() string { return s.name }
+func (s strategyFunc) Select(rides []Ride, req SelectionRequest) (Ride, bool) {
+	return s.selectFn(rides, req)
+}
+
+// NewStrategy adapts a function to RideSelectionStrategy.
+func NewStrategy(name string, selectFn func([]Ride, SelectionRequest) (Ride, bool)) RideSelectionStrategy {
+	return strategyFunc{name: name, selectFn: selectFn}
+}
+
+// withParam fixes the Param a strategy sees, so each strategy in a fallback
+// chain keeps its own argument.
+type withParam struct {
+	RideSelectionStrategy
+	param string
+}
+
+func (s withParam) Select(rides []Ride, req SelectionRequest) (Ride, bool) {
+	req.Param = s.param
+	return s.RideSelectionStrategy.Select(rides, req)
+}
+
+type fallbackStrategy []RideSelectionStrategy
+
+// Fallback tries each strategy in turn until one selects a ride.
+func Fallback(strategies ...RideSelectionStrategy) RideSelectionStrategy {
+	return fallbackStrategy(strategies)
+}
+
+func (f fallbackStrategy) Name() string {
+	names := make([]string, len(f))
+	for i, s := range f {
+		names[i] = s.Name()
+	}
+	return strings.Join(names, " | ")
+}
+
+func (f fallbackStrategy) Select(rides []Ride, req SelectionRequest) (Ride, bool) {
+	for _, s := range f {
+		if ride, ok := s.Select(rides, req); ok {
+			return ride, true
+		}
+	}
+	return Ride{}, false
+}
+
+//////
+
+// StrategyRegistry maps strategy names, as used in preferences, to strategies.
+type StrategyRegistry struct {
+	mu         sync.RWMutex
+	strategies map[string]RideSelectionStrategy
+}
+
+// NewStrategyRegistry returns a registry holding the built-in strategies.
+func NewStrategyRegistry() *StrategyRegistry {
+	rg := &StrategyRegistry{strategies: make(map[string]RideSelectionStrategy)}
+	for _, s := range builtinStrategies() {
+		rg.strategies[s.Name()] = s
+	}
+	return rg
+}
+
+// Register adds a strategy under its name.
+func (rg *StrategyRegistry) Register(s RideSelectionStrategy) error {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	if _, exists := rg.strategies[s.Name()]; exists {
+		return fmt.Errorf("strategy %q already registered", s.Name())
+	}
+	rg.strategies[s.Name()] = s
+	return nil
+}
+
+func (rg *StrategyRegistry) Lookup(name string) (RideSelectionStrategy, bool) {
+	rg.mu.RLock()
+	defer rg.mu.RUnlock()
+	s, ok := rg.strategies[name]
+	return s, ok
+}
+
+// Resolve turns a preference such as "Preferred Vehicle=Toyota|Most Vacant"
+// into a strategy: each "|"-separated entry names a registered strategy with
+// an optional "=param", and later entries are fallbacks for earlier ones.
+func (rg *StrategyRegistry) Resolve(preference string) (RideSelectionStrategy, error) {
+	var chain []RideSelectionStrategy
+	for _, entry := range strings.Split(preference, "|") {
+		name, param, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		s, ok := rg.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown selection strategy %q", name)
+		}
+		chain = append(chain, withParam{RideSelectionStrategy: s, param: param})
+	}
+	if len(chain) == 1 {
+		return chain[0], nil
+	}
+	return Fallback(chain...), nil
+}
+
+// defaultStrategies is the registry every rideManager starts with.
+var defaultStrategies = NewStrategyRegistry()
+
+// RegisterStrategy makes a strategy available to every rideManager by name.
+func RegisterStrategy(s RideSelectionStrategy) error {
+	return defaultStrategies.Register(s)
+}
+
+// sortRidesByID orders candidates so strategies break ties the same way every
+// time.
+func sortRidesByID(rides []Ride) {
+	sort.Slice(rides, func(i, j int) bool { return rides[i].ID < rides[j].ID })
+}
+
+//////
+
+func builtinStrategies() []RideSelectionStrategy {
+	return []RideSelectionStrategy{
+		NewStrategy(string(PreferredVehicle), func(rides []Ride, req SelectionRequest) (Ride, bool) {
+			for _, ride := range rides {
+				vehicle, err := req.Vehicle(ride.VehicleID)
+				if err == nil && inModelFamily(vehicle.Model, req.Param) {
+					return ride, true
+				}
+			}
+			return Ride{}, false
+		}),
+		NewStrategy(string(MostVacantSeats), func(rides []Ride, req SelectionRequest) (Ride, bool) {
+			var selected Ride
+			maxSeats := -1
+			for _, ride := range rides {
+				if ride.AvailableSeats > maxSeats {
+					maxSeats = ride.AvailableSeats
+					selected = ride
+				}
+			}
+			return selected, maxSeats >= 0
+		}),
+		NewStrategy(string(EarliestDeparture), func(rides []Ride, req SelectionRequest) (Ride, bool) {
+			var selected Ride
+			found := false
+			for _, ride := range rides {
+				if !ride.IsScheduled() {
+					continue
+				}
+				if !found || ride.DepartureTime.Before(selected.DepartureTime) {
+					selected, found = ride, true
+				}
+			}
+			return selected, found
+		}),
+		NewStrategy(string(CheapestRide), func(rides []Ride, req SelectionRequest) (Ride, bool) {
+			if req.Fare == nil || len(rides) == 0 {
+				return Ride{}, false
+			}
+			selected := rides[0]
+			for _, ride := range rides[1:] {
+				if req.Fare(ride) < req.Fare(selected) {
+					selected = ride
+				}
+			}
+			return selected, true
+		}),
+	}
+}
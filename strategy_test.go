@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func newStrategyFixture(t *testing.T) *rideManager {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	rideMgr.now = func() time.Time { return now }
+
+	rides := []struct {
+		ride  Ride
+		model string
+	}{
+		{Ride{ID: "1", Source: "A", Destination: "B", AvailableSeats: 2, DepartureTime: now.Add(3 * time.Hour), ArrivalTime: now.Add(4 * time.Hour)}, "Toyota"},
+		{Ride{ID: "2", Source: "A", Destination: "B", AvailableSeats: 6, DepartureTime: now.Add(2 * time.Hour), ArrivalTime: now.Add(3 * time.Hour)}, "XUV"},
+		{Ride{ID: "3", Source: "A", Destination: "B", AvailableSeats: 4, DepartureTime: now.Add(time.Hour), ArrivalTime: now.Add(2 * time.Hour)}, "Swift"},
+	}
+	for _, r := range rides {
+		_ = userMgr.AddUser(User{ID: r.ride.ID, Name: "Driver" + r.ride.ID, Role: Driver})
+		_ = vehicleMgr.AddVehicle(Vehicle{ID: r.ride.ID, OwnerID: r.ride.ID, Model: r.model, Capacity: 7})
+		r.ride.DriverID, r.ride.VehicleID = r.ride.ID, r.ride.ID
+		if err := rideMgr.OfferRide(r.ride); err != nil {
+			t.Fatalf("Error offering ride: %v", err)
+		}
+	}
+	return rideMgr
+}
+
+// Test the built-in strategies and fallback chains
+func TestStrategies(t *testing.T) {
+	rideMgr := newStrategyFixture(t)
+	rideMgr.SetFareFunc(func(r Ride) float64 { return float64(10 - r.AvailableSeats) })
+
+	tests := []struct {
+		preference string
+		expected   string
+	}{
+		{preference: "Most Vacant", expected: "2"},
+		{preference: "Preferred Vehicle=Toyota", expected: "1"},
+		{preference: "Earliest Departure", expected: "3"},
+		{preference: "Lowest Fare", expected: "2"},
+		{preference: "Preferred Vehicle=Tesla|Earliest Departure", expected: "3"},
+		{preference: "Preferred Vehicle=Tesla | Preferred Vehicle=Swift | Most Vacant", expected: "3"},
+	}
+	for _, tt := range tests {
+		it, err := rideMgr.Quote("A", "B", 1, tt.preference, TimeWindow{})
+		if err != nil {
+			t.Fatalf("%s: expected no error, but got %v", tt.preference, err)
+		}
+		if got := it.Legs[0].Ride.ID; got != tt.expected {
+			t.Fatalf("%s: expected ride %s, but got %s", tt.preference, tt.expected, got)
+		}
+	}
+
+	if _, err := rideMgr.Quote("A", "B", 1, "Preferred Vehicle=Tesla", TimeWindow{}); err == nil {
+		t.Fatalf("Expected error when no ride matches and there is no fallback")
+	}
+	if _, err := rideMgr.Quote("A", "B", 1, "Most Vacant|Teleport", TimeWindow{}); err == nil {
+		t.Fatalf("Expected error for an unknown strategy")
+	}
+}
+
+// Test registering a custom strategy without touching rideManager
+func TestRegisterStrategy(t *testing.T) {
+	rideMgr := newStrategyFixture(t)
+	rideMgr.strategies = NewStrategyRegistry()
+
+	fewestSeats := NewStrategy("Fewest Seats", func(rides []Ride, req SelectionRequest) (Ride, bool) {
+		if len(rides) == 0 {
+			return Ride{}, false
+		}
+		selected := rides[0]
+		for _, ride := range rides[1:] {
+			if ride.AvailableSeats < selected.AvailableSeats {
+				selected = ride
+			}
+		}
+		return selected, true
+	})
+	if err := rideMgr.strategies.Register(fewestSeats); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := rideMgr.strategies.Register(fewestSeats); err == nil {
+		t.Fatalf("Expected error registering the same name twice")
+	}
+
+	booking, err := rideMgr.SelectRide("p1", "A", "B", 1, "Fewest Seats")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if booking.Legs[0].ID != "1" {
+		t.Fatalf("Expected ride 1, but got %s", booking.Legs[0].ID)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// SurgePolicy raises fares on a route while searches for it outnumber the
+// seats recently offered on it.
+type SurgePolicy struct {
+	Window time.Duration               // how far back searches and offered seats are counted
+	Curve  func(ratio float64) float64 // multiplier for searches per offered seat; LinearSurge(1, 0.5) if nil
+	Max    float64                     // cap on the multiplier, at least 1
+}
+
+// LinearSurge returns a curve that charges 1x up to threshold searches per
+// offered seat and adds slope for every search per seat beyond it.
+func LinearSurge(threshold, slope float64) func(float64) float64 {
+	return func(ratio float64) float64 {
+		if ratio <= threshold {
+			return 1
+		}
+		return 1 + slope*(ratio-threshold)
+	}
+}
+
+// multiplier applies the curve to ratio, clamped to [1, Max] and rounded to
+// two decimals so the value recorded on a booking is the one charged.
+func (p SurgePolicy) multiplier(ratio float64) float64 {
+	curve := p.Curve
+	if curve == nil {
+		curve = LinearSurge(1, 0.5)
+	}
+	m := math.Min(math.Max(curve(ratio), 1), p.Max)
+	return math.Round(m*100) / 100
+}
+
+type seatOffer struct {
+	at    time.Time
+	seats int
+}
+
+// surgeTracker counts searches and offered seats per route over the policy's
+// window. It is safe for concurrent use.
+type surgeTracker struct {
+	mu       sync.Mutex
+	policy   SurgePolicy
+	searches map[routeKey][]time.Time
+	offers   map[routeKey][]seatOffer
+}
+
+func newSurgeTracker(policy SurgePolicy) *surgeTracker {
+	return &surgeTracker{
+		policy:   policy,
+		searches: make(map[routeKey][]time.Time),
+		offers:   make(map[routeKey][]seatOffer),
+	}
+}
+
+// prune drops what happened before the window ending at now. Both lists are
+// in the order recorded, so the stale entries are a prefix.
+func (t *surgeTracker) prune(key routeKey, now time.Time) {
+	cutoff := now.Add(-t.policy.Window)
+	searches := t.searches[key]
+	i := 0
+	for i < len(searches) && searches[i].Before(cutoff) {
+		i++
+	}
+	if t.searches[key] = searches[i:]; len(t.searches[key]) == 0 {
+		delete(t.searches, key)
+	}
+	offers := t.offers[key]
+	j := 0
+	for j < len(offers) && offers[j].at.Before(cutoff) {
+		j++
+	}
+	if t.offers[key] = offers[j:]; len(t.offers[key]) == 0 {
+		delete(t.offers, key)
+	}
+}
+
+func (t *surgeTracker) recordSearch(key routeKey, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune(key, now)
+	t.searches[key] = append(t.searches[key], now)
+}
+
+func (t *surgeTracker) recordOffer(ride Ride, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range routeKeys(ride) {
+		t.prune(key, now)
+		t.offers[key] = append(t.offers[key], seatOffer{at: now, seats: ride.AvailableSeats})
+	}
+}
+
+// multiplier returns the surge on key at now. A route with no seats offered on
+// it directly in the window is only served by connections, whose supply isn't
+// tracked, so it does not surge.
+func (t *surgeTracker) multiplier(key routeKey, now time.Time) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune(key, now)
+	seats := 0
+	for _, offer := range t.offers[key] {
+		seats += offer.seats
+	}
+	if seats == 0 {
+		return 1
+	}
+	return t.policy.multiplier(float64(len(t.searches[key])) / float64(seats))
+}
+
+// SetSurgePolicy starts pricing fares by demand: each search from a source to
+// a destination counts against the seats OfferRide has offered between them
+// within the policy's window. Counting starts afresh from the call.
+func (rm *rideManager) SetSurgePolicy(policy SurgePolicy) error {
+	if policy.Window <= 0 {
+		return fmt.Errorf("surge window must be positive")
+	}
+	if policy.Max < 1 {
+		return fmt.Errorf("surge cap must be at least 1, got %v", policy.Max)
+	}
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.surge = newSurgeTracker(policy)
+	return nil
+}
+
+func (rm *rideManager) currentSurge() *surgeTracker {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	return rm.surge
+}
+
+// recordSearch counts a passenger search from source to destination towards
+// the demand on that route.
+func (rm *rideManager) recordSearch(source, destination string) {
+	if surge := rm.currentSurge(); surge != nil {
+		surge.recordSearch(routeKey{source, destination}, rm.now())
+	}
+}
+
+// recordOffer counts a new ride's seats towards the supply on every route it
+// serves.
+func (rm *rideManager) recordOffer(ride Ride) {
+	if surge := rm.currentSurge(); surge != nil {
+		surge.recordOffer(ride, rm.now())
+	}
+}
+
+// surgeMultiplier returns the factor fares from source to destination are
+// raised by now; 1 without a surge policy.
+func (rm *rideManager) surgeMultiplier(source, destination string) float64 {
+	surge := rm.currentSurge()
+	if surge == nil {
+		return 1
+	}
+	return surge.multiplier(routeKey{source, destination}, rm.now())
+}
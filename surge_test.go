@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test the surge curve is clamped between 1 and the cap
+func TestSurgePolicyMultiplier(t *testing.T) {
+	policy := SurgePolicy{Window: time.Hour, Curve: LinearSurge(2, 0.25), Max: 1.5}
+	tests := []struct {
+		ratio    float64
+		expected float64
+	}{
+		{ratio: 0, expected: 1},
+		{ratio: 2, expected: 1},
+		{ratio: 3, expected: 1.25},
+		{ratio: 10, expected: 1.5},
+	}
+	for _, tt := range tests {
+		if got := policy.multiplier(tt.ratio); got != tt.expected {
+			t.Fatalf("Ratio %v: expected %v, but got %v", tt.ratio, tt.expected, got)
+		}
+	}
+
+	shrinking := SurgePolicy{Window: time.Hour, Curve: func(float64) float64 { return 0.5 }, Max: 2}
+	if got := shrinking.multiplier(5); got != 1 {
+		t.Fatalf("Expected surge never to lower fares, but got %v", got)
+	}
+}
+
+// Test that invalid surge policies are rejected
+func TestSetSurgePolicyValidation(t *testing.T) {
+	rideMgr := newStrategyFixture(t)
+	if err := rideMgr.SetSurgePolicy(SurgePolicy{Max: 2}); err == nil {
+		t.Fatalf("Expected an error for a policy without a window, but got nil")
+	}
+	if err := rideMgr.SetSurgePolicy(SurgePolicy{Window: time.Hour, Max: 0.5}); err == nil {
+		t.Fatalf("Expected an error for a cap below 1, but got nil")
+	}
+}
+
+// Test that fares rise with searches per offered seat, are capped, fall back
+// once the window passes and are recorded on bookings
+func TestSurgePricing(t *testing.T) {
+	rideMgr := newStrategyFixture(t)
+	now := rideMgr.now()
+	rideMgr.now = func() time.Time { return now }
+	rideMgr.SetFareFunc(func(Ride) float64 { return 100 })
+	if err := rideMgr.SetSurgePolicy(SurgePolicy{Window: time.Hour, Curve: LinearSurge(1, 0.5), Max: 2}); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	// Only seats offered under the policy count as supply: 4 seats on A to B.
+	ride := Ride{ID: "4", DriverID: "1", VehicleID: "1", Source: "A", Destination: "B", AvailableSeats: 4, DepartureTime: now.Add(5 * time.Hour), ArrivalTime: now.Add(6 * time.Hour)}
+	if err := rideMgr.OfferRide(ride); err != nil {
+		t.Fatalf("Error offering ride: %v", err)
+	}
+
+	quote := func() Itinerary {
+		it, err := rideMgr.Quote("A", "B", 2, "", TimeWindow{})
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		return it
+	}
+	for i := 0; i < 4; i++ {
+		if it := quote(); it.SurgeMultiplier != 1 || it.Legs[0].Fare != 100 {
+			t.Fatalf("Expected no surge with a search per seat, but got x%v and a fare of %v", it.SurgeMultiplier, it.Legs[0].Fare)
+		}
+	}
+	quote()
+
+	// The sixth search is 1.5 searches per seat.
+	booking, err := rideMgr.SelectRide("passenger", "A", "B", 2, "")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if booking.SurgeMultiplier != 1.25 || booking.Price != 250 {
+		t.Fatalf("Expected x1.25 and a price of 250, but got x%v and %v", booking.SurgeMultiplier, booking.Price)
+	}
+	stored, err := rideMgr.GetBookingByID(booking.ID)
+	if err != nil || stored.SurgeMultiplier != 1.25 {
+		t.Fatalf("Expected the multiplier to be stored with the booking, but got %+v (%v)", stored, err)
+	}
+
+	for i := 0; i < 20; i++ {
+		quote()
+	}
+	if it := quote(); it.SurgeMultiplier != 2 || it.Price != 400 {
+		t.Fatalf("Expected the cap of x2 and a price of 400, but got x%v and %v", it.SurgeMultiplier, it.Price)
+	}
+	if m := rideMgr.surgeMultiplier("B", "A"); m != 1 {
+		t.Fatalf("Expected other routes to be unaffected, but got x%v", m)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if it := quote(); it.SurgeMultiplier != 1 {
+		t.Fatalf("Expected the surge to end with the window, but got x%v", it.SurgeMultiplier)
+	}
+}
+
+// Test that a route served only by connections doesn't surge however often it
+// is searched
+func TestSurgeIndirectRoute(t *testing.T) {
+	rideMgr := newStrategyFixture(t)
+	now := rideMgr.now()
+	rideMgr.SetFareFunc(func(Ride) float64 { return 100 })
+	if err := rideMgr.SetSurgePolicy(SurgePolicy{Window: time.Hour, Curve: LinearSurge(1, 0.5), Max: 2}); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	ride := Ride{ID: "4", DriverID: "1", VehicleID: "1", Source: "B", Destination: "C", AvailableSeats: 4, DepartureTime: now.Add(5 * time.Hour), ArrivalTime: now.Add(6 * time.Hour)}
+	if err := rideMgr.OfferRide(ride); err != nil {
+		t.Fatalf("Error offering ride: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		it, err := rideMgr.Quote("A", "C", 1, "", TimeWindow{})
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if len(it.Legs) != 2 || it.SurgeMultiplier != 1 {
+			t.Fatalf("Expected a connection at x1, but got %d legs at x%v", len(it.Legs), it.SurgeMultiplier)
+		}
+	}
+}
@@ -6,6 +6,7 @@ type Vehicle struct {
 	ID       string
 	OwnerID  string
 	Model    string
+	Category VehicleCategory
 	Capacity int
 }
 
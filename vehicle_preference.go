@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoMatchingVehicle reports that rides with enough seats exist but none is
+// in a vehicle the passenger will ride in.
+var ErrNoMatchingVehicle = errors.New("no ride in a matching vehicle")
+
+type VehicleCategory string
+
+const (
+	Hatchback VehicleCategory = "Hatchback"
+	Sedan     VehicleCategory = "Sedan"
+	SUV       VehicleCategory = "SUV"
+	Van       VehicleCategory = "Van"
+)
+
+// vehicleCategories lists the categories a preference may ask for.
+var vehicleCategories = []VehicleCategory{Hatchback, Sedan, SUV, Van}
+
+// VehiclePreference describes the vehicles a passenger will ride in. Empty
+// fields accept any vehicle.
+type VehiclePreference struct {
+	Model       string // a model, or a family such as "Toyota" matching "Toyota Innova"
+	Category    VehicleCategory
+	MinCapacity int
+	MaxCapacity int  // zero means no upper bound
+	Degrade     bool // fall back to the next-best vehicle when none match
+}
+
+// Matches reports whether vehicle satisfies every criterion of the preference.
+func (p VehiclePreference) Matches(vehicle Vehicle) bool {
+	if p.Model != "" && !inModelFamily(vehicle.Model, p.Model) {
+		return false
+	}
+	if p.Category != "" && !strings.EqualFold(string(vehicle.Category), string(p.Category)) {
+		return false
+	}
+	if vehicle.Capacity < p.MinCapacity {
+		return false
+	}
+	return p.MaxCapacity == 0 || vehicle.Capacity <= p.MaxCapacity
+}
+
+// relax drops the most specific criterion, model before category before
+// capacity, and says what could not be found. It returns false once nothing
+// is left to drop.
+func (p VehiclePreference) relax() (VehiclePreference, string, bool) {
+	switch {
+	case p.Model != "":
+		reason := fmt.Sprintf("no %s vehicle available", p.Model)
+		p.Model = ""
+		return p, reason, true
+	case p.Category != "":
+		reason := fmt.Sprintf("no %s available", p.Category)
+		p.Category = ""
+		return p, reason, true
+	case p.MinCapacity != 0 || p.MaxCapacity != 0:
+		reason := fmt.Sprintf("no vehicle with capacity %s available", p.capacityRange())
+		p.MinCapacity, p.MaxCapacity = 0, 0
+		return p, reason, true
+	}
+	return p, "", false
+}
+
+func (p VehiclePreference) capacityRange() string {
+	if p.MaxCapacity == 0 {
+		return fmt.Sprintf("%d+", p.MinCapacity)
+	}
+	return fmt.Sprintf("%d-%d", p.MinCapacity, p.MaxCapacity)
+}
+
+// inModelFamily reports whether model is family itself or one of its
+// variants, compared case-insensitively word by word.
+func inModelFamily(model, family string) bool {
+	modelWords, familyWords := strings.Fields(model), strings.Fields(family)
+	if len(familyWords) == 0 || len(familyWords) > len(modelWords) {
+		return false
+	}
+	for i, word := range familyWords {
+		if !strings.EqualFold(modelWords[i], word) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseVehicleCategory returns the known category named by s.
+func parseVehicleCategory(s string) (VehicleCategory, error) {
+	for _, category := range vehicleCategories {
+		if strings.EqualFold(s, string(category)) {
+			return category, nil
+		}
+	}
+	return "", fmt.Errorf("unknown vehicle category %q", s)
+}
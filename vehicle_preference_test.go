@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newVehicleFixture offers direct rides X->Y in three vehicles and two
+// two-leg routes A->C, one by SUV through B and one by sedan through E.
+func newVehicleFixture(t *testing.T) *rideManager {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	rideMgr.now = func() time.Time { return now }
+
+	rides := []struct {
+		ride    Ride
+		vehicle Vehicle
+	}{
+		{Ride{ID: "XY1", Source: "X", Destination: "Y", AvailableSeats: 7}, Vehicle{Model: "Toyota Innova", Category: Van, Capacity: 8}},
+		{Ride{ID: "XY2", Source: "X", Destination: "Y", AvailableSeats: 3}, Vehicle{Model: "Toyota Etios", Category: Sedan, Capacity: 4}},
+		{Ride{ID: "XY3", Source: "X", Destination: "Y", AvailableSeats: 4}, Vehicle{Model: "Maruti Swift", Category: Hatchback, Capacity: 4}},
+		{Ride{ID: "AB", Source: "A", Destination: "B", AvailableSeats: 4}, Vehicle{Model: "Mahindra XUV", Category: SUV, Capacity: 7}},
+		{Ride{ID: "BC", Source: "B", Destination: "C", AvailableSeats: 4}, Vehicle{Model: "Mahindra XUV", Category: SUV, Capacity: 7}},
+		{Ride{ID: "AE", Source: "A", Destination: "E", AvailableSeats: 4}, Vehicle{Model: "Honda City", Category: Sedan, Capacity: 5}},
+		{Ride{ID: "EC", Source: "E", Destination: "C", AvailableSeats: 4}, Vehicle{Model: "Honda City", Category: Sedan, Capacity: 5}},
+	}
+	for _, r := range rides {
+		id := r.ride.ID
+		_ = userMgr.AddUser(User{ID: id, Name: "Driver" + id, Role: Driver})
+		r.vehicle.ID, r.vehicle.OwnerID = id, id
+		_ = vehicleMgr.AddVehicle(r.vehicle)
+		r.ride.DriverID, r.ride.VehicleID = id, id
+		if err := rideMgr.OfferRide(r.ride); err != nil {
+			t.Fatalf("Error offering ride: %v", err)
+		}
+	}
+	return rideMgr
+}
+
+// Test matching vehicles by model family, category and capacity
+func TestVehiclePreferenceMatches(t *testing.T) {
+	innova := Vehicle{Model: "Toyota Innova Crysta", Category: Van, Capacity: 8}
+	tests := []struct {
+		preference VehiclePreference
+		expected   bool
+	}{
+		{preference: VehiclePreference{}, expected: true},
+		{preference: VehiclePreference{Model: "Toyota"}, expected: true},
+		{preference: VehiclePreference{Model: "toyota innova"}, expected: true},
+		{preference: VehiclePreference{Model: "Toyota Inn"}, expected: false},
+		{preference: VehiclePreference{Model: "Innova"}, expected: false},
+		{preference: VehiclePreference{Category: "van"}, expected: true},
+		{preference: VehiclePreference{Category: SUV}, expected: false},
+		{preference: VehiclePreference{MinCapacity: 6, MaxCapacity: 8}, expected: true},
+		{preference: VehiclePreference{MaxCapacity: 7}, expected: false},
+		{preference: VehiclePreference{MinCapacity: 9}, expected: false},
+	}
+	for _, tt := range tests {
+		if got := tt.preference.Matches(innova); got != tt.expected {
+			t.Fatalf("%+v: expected %v, but got %v", tt.preference, tt.expected, got)
+		}
+	}
+}
+
+// Test that vehicle preferences filter direct and indirect rides alike
+func TestQuoteVehiclePreference(t *testing.T) {
+	rideMgr := newVehicleFixture(t)
+
+	tests := []struct {
+		source     string
+		preference string
+		expected   string
+	}{
+		{source: "X", preference: "vehicle=Toyota", expected: "[XY1]"},
+		{source: "X", preference: "vehicle=Toyota;maxCapacity=4", expected: "[XY2]"},
+		{source: "X", preference: "category=hatchback", expected: "[XY3]"},
+		{source: "X", preference: "Preferred Vehicle=Toyota", expected: "[XY1]"},
+		{source: "A", preference: "category=Sedan", expected: "[AE EC]"},
+		{source: "A", preference: "vehicle=Mahindra", expected: "[AB BC]"},
+		{source: "A", preference: "minCapacity=6", expected: "[AB BC]"},
+		{source: "A", preference: "Preferred Vehicle=Honda|Most Vacant", expected: "[AE EC]"},
+	}
+	for _, tt := range tests {
+		destination := map[string]string{"X": "Y", "A": "C"}[tt.source]
+		it, err := rideMgr.Quote(tt.source, destination, 1, tt.preference, TimeWindow{})
+		if err != nil {
+			t.Fatalf("%s: expected no error, but got %v", tt.preference, err)
+		}
+		if got := fmt.Sprint(routeIDs(it.Rides())); got != tt.expected {
+			t.Fatalf("%s: expected %s, but got %s", tt.preference, tt.expected, got)
+		}
+		if it.Degraded != "" {
+			t.Fatalf("%s: expected no degradation, but got %q", tt.preference, it.Degraded)
+		}
+	}
+
+	for _, preference := range []string{"vehicle=Tata", "category=Van;minCapacity=9"} {
+		if _, err := rideMgr.Quote("X", "Y", 1, preference, TimeWindow{}); err == nil {
+			t.Fatalf("%s: expected error, but got none", preference)
+		}
+		if _, err := rideMgr.Quote("A", "C", 1, preference, TimeWindow{}); err == nil {
+			t.Fatalf("%s: expected error for indirect routes, but got none", preference)
+		}
+	}
+}
+
+// Test degrading to the next-best vehicle and reporting why
+func TestQuoteVehiclePreferenceDegrades(t *testing.T) {
+	rideMgr := newVehicleFixture(t)
+
+	it, err := rideMgr.Quote("X", "Y", 1, "vehicle=Tata;category=Sedan;degrade=true", TimeWindow{})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if it.Legs[0].Ride.ID != "XY2" || it.Degraded != "no Tata vehicle available" {
+		t.Fatalf("Expected the sedan XY2 with a reason, but got %s (%q)", it.Legs[0].Ride.ID, it.Degraded)
+	}
+
+	it, err = rideMgr.Quote("A", "C", 1, "category=Van;minCapacity=6;degrade=true", TimeWindow{})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if got := fmt.Sprint(routeIDs(it.Rides())); got != "[AB BC]" || it.Degraded != "no Van available" {
+		t.Fatalf("Expected [AB BC] by SUV with a reason, but got %s (%q)", got, it.Degraded)
+	}
+
+	it, err = rideMgr.Quote("A", "C", 1, "vehicle=Tata;minCapacity=9;degrade=true", TimeWindow{})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !strings.Contains(it.Degraded, "no Tata vehicle available") || !strings.Contains(it.Degraded, "capacity 9+") {
+		t.Fatalf("Expected both relaxations reported, but got %q", it.Degraded)
+	}
+
+	itineraries, err := rideMgr.SearchItineraries("A", "C", 1, 2, RouteOptions{Vehicle: VehiclePreference{Category: Van, Degrade: true}})
+	if err != nil || len(itineraries) != 2 {
+		t.Fatalf("Expected two itineraries, but got %d (%v)", len(itineraries), err)
+	}
+	if itineraries[0].Degraded != "no Van available" {
+		t.Fatalf("Expected the reason on searched itineraries, but got %q", itineraries[0].Degraded)
+	}
+}
+
+// Test that only a vehicle mismatch is reported as one, so other failures
+// don't relax the preference
+func TestQuoteVehicleMismatch(t *testing.T) {
+	rideMgr := newVehicleFixture(t)
+
+	tests := []struct {
+		source, destination string
+		seats               int
+		preference          string
+		mismatch            bool
+	}{
+		{source: "X", destination: "Y", seats: 1, preference: "vehicle=Tata", mismatch: true},
+		{source: "X", destination: "Y", seats: 8, preference: "vehicle=Tata;degrade=true", mismatch: false},
+		{source: "A", destination: "C", seats: 1, preference: "category=Van", mismatch: true},
+		{source: "A", destination: "C", seats: 5, preference: "category=Van;degrade=true", mismatch: false},
+	}
+	for _, tt := range tests {
+		_, err := rideMgr.Quote(tt.source, tt.destination, tt.seats, tt.preference, TimeWindow{})
+		if err == nil {
+			t.Fatalf("%s: expected an error, but got nil", tt.preference)
+		}
+		if errors.Is(err, ErrNoMatchingVehicle) != tt.mismatch {
+			t.Fatalf("%s for %d seat(s): expected mismatch %v, but got %v", tt.preference, tt.seats, tt.mismatch, err)
+		}
+	}
+}
+
+// Test that a chain of rides in the preferred vehicle wins over relaxing the
+// preference for a direct ride in another
+func TestQuoteVehiclePreferenceIndirect(t *testing.T) {
+	rideMgr := newVehicleFixture(t)
+	_ = rideMgr.userMgr.AddUser(User{ID: "AC", Name: "DriverAC", Role: Driver})
+	_ = rideMgr.vehicleMgr.AddVehicle(Vehicle{ID: "AC", OwnerID: "AC", Model: "Maruti Swift", Category: Hatchback, Capacity: 4})
+	if err := rideMgr.OfferRide(Ride{ID: "AC", DriverID: "AC", VehicleID: "AC", Source: "A", Destination: "C", AvailableSeats: 4}); err != nil {
+		t.Fatalf("Error offering ride: %v", err)
+	}
+
+	for _, preference := range []string{"category=SUV", "category=SUV;degrade=true"} {
+		it, err := rideMgr.Quote("A", "C", 1, preference, TimeWindow{})
+		if err != nil {
+			t.Fatalf("%s: expected no error, but got %v", preference, err)
+		}
+		if got := fmt.Sprint(Booking{Legs: it.Rides()}.RideIDs()); got != "[AB BC]" || it.Degraded != "" {
+			t.Fatalf("%s: expected [AB BC] without degrading, but got %s (%q)", preference, got, it.Degraded)
+		}
+	}
+}
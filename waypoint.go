@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Waypoint is an intermediate stop of a ride where passengers may board or
+// alight.
+type Waypoint struct {
+	Place string
+	Time  time.Time // when the ride stops there; zero for an unscheduled ride
+}
+
+// Route returns every place the ride stops at, from Source to Destination.
+func (r Ride) Route() []string {
+	route := make([]string, 0, len(r.Stops)+2)
+	route = append(route, r.Source)
+	for _, stop := range r.Stops {
+		route = append(route, stop.Place)
+	}
+	return append(route, r.Destination)
+}
+
+// timeAt returns when the ride is at the i-th place of its route.
+func (r Ride) timeAt(i int) time.Time {
+	switch i {
+	case 0:
+		return r.DepartureTime
+	case len(r.Stops) + 1:
+		return r.ArrivalTime
+	default:
+		return r.Stops[i-1].Time
+	}
+}
+
+// seatsOn returns the free seats on the i-th segment of the route.
+func (r Ride) seatsOn(i int) int {
+	if r.SegmentSeats == nil {
+		return r.AvailableSeats
+	}
+	return r.SegmentSeats[i]
+}
+
+// segmentRange returns the segments [from, to) travelled from source to
+// destination, or false if the ride doesn't go from one to the other.
+func (r Ride) segmentRange(source, destination string) (int, int, bool) {
+	from, to := -1, -1
+	for i, place := range r.Route() {
+		if place == source && from < 0 {
+			from = i
+		}
+		if place == destination && from >= 0 && i > from {
+			to = i
+			break
+		}
+	}
+	return from, to, from >= 0 && to > from
+}
+
+// Segment returns the part of the ride from source to destination as a ride
+// of its own: same ID, driver and vehicle, with the stops, times and free
+// seats of just that part. Booking legs are segments.
+func (r Ride) Segment(source, destination string) (Ride, bool) {
+	from, to, ok := r.segmentRange(source, destination)
+	if !ok {
+		return Ride{}, false
+	}
+	if from == 0 && to == len(r.Stops)+1 {
+		return r, true
+	}
+	segment := r
+	segment.Source, segment.Destination = source, destination
+	segment.DepartureTime, segment.ArrivalTime = r.timeAt(from), r.timeAt(to)
+	if from != 0 {
+		segment.SourceLocation = Location{}
+	}
+	segment.Stops = append([]Waypoint(nil), r.Stops[from:to-1]...)
+	segment.SegmentSeats = nil
+	if r.SegmentSeats != nil {
+		segment.SegmentSeats = append([]int(nil), r.SegmentSeats[from:to]...)
+	}
+	segment.AvailableSeats = segment.minSeats()
+	return segment, true
+}
+
+// minSeats returns the seats free on every segment of the ride.
+func (r Ride) minSeats() int {
+	if r.SegmentSeats == nil {
+		return r.AvailableSeats
+	}
+	seats := r.SegmentSeats[0]
+	for _, s := range r.SegmentSeats[1:] {
+		seats = min(seats, s)
+	}
+	return seats
+}
+
+// adjustSeats adds delta free seats to segments [from, to) and keeps
+// AvailableSeats equal to the seats free end to end.
+func (r *Ride) adjustSeats(from, to, delta int) {
+	if r.SegmentSeats == nil {
+		r.AvailableSeats += delta
+		return
+	}
+	r.SegmentSeats = append([]int(nil), r.SegmentSeats...)
+	for i := from; i < to; i++ {
+		r.SegmentSeats[i] += delta
+	}
+	r.AvailableSeats = r.minSeats()
+}
+
+// validateStops checks that a ride visits each place once and, if scheduled,
+// reaches its stops in order between departure and arrival.
+func (r Ride) validateStops() error {
+	seen := make(map[string]bool)
+	for _, place := range r.Route() {
+		if place == "" {
+			return fmt.Errorf("ride %s has a stop without a place", r.ID)
+		}
+		if seen[place] {
+			return fmt.Errorf("ride %s visits %s more than once", r.ID, place)
+		}
+		seen[place] = true
+	}
+	prev := r.DepartureTime
+	for _, stop := range r.Stops {
+		if !r.IsScheduled() {
+			if !stop.Time.IsZero() {
+				return fmt.Errorf("ride %s has a time at %s but no departure time", r.ID, stop.Place)
+			}
+			continue
+		}
+		if !stop.Time.After(prev) {
+			return fmt.Errorf("ride %s must reach %s after its previous stop", r.ID, stop.Place)
+		}
+		prev = stop.Time
+	}
+	if r.IsScheduled() && !r.ArrivalTime.After(prev) {
+		return fmt.Errorf("ride %s must arrive after its last stop", r.ID)
+	}
+	return nil
+}
+
+// SegmentAvailability is the number of seats free between two consecutive
+// stops of a ride.
+type SegmentAvailability struct {
+	From  string
+	To    string
+	Seats int
+}
+
+// Availability returns the seats free on each segment of the ride's route.
+func (r Ride) Availability() []SegmentAvailability {
+	route := r.Route()
+	segments := make([]SegmentAvailability, len(route)-1)
+	for i := range segments {
+		segments[i] = SegmentAvailability{From: route[i], To: route[i+1], Seats: r.seatsOn(i)}
+	}
+	return segments
+}
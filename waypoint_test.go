@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newMultiStopFixture offers one ride A->B->C->D with two seats.
+func newMultiStopFixture(t *testing.T) (*rideManager, RideStorage, time.Time) {
+	userStorage := NewInMemoryUserStorage()
+	vehicleStorage := NewInMemoryVehicleStorage()
+	rideStorage := NewInMemoryRideStorage()
+
+	userMgr := NewUserManager(userStorage)
+	vehicleMgr := NewVehicleManager(vehicleStorage, userMgr)
+	rideMgr := NewRideManager(rideStorage, NewInMemoryBookingStorage(), userMgr, vehicleMgr)
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	rideMgr.now = func() time.Time { return now }
+
+	_ = userMgr.AddUser(User{ID: "1", Name: "Driver1", Role: Driver})
+	_ = vehicleMgr.AddVehicle(Vehicle{ID: "1", OwnerID: "1", Model: "XUV", Capacity: 7})
+	ride := Ride{
+		ID: "1", DriverID: "1", VehicleID: "1", Source: "A", Destination: "D", AvailableSeats: 2,
+		Stops:         []Waypoint{{Place: "B", Time: now.Add(2 * time.Hour)}, {Place: "C", Time: now.Add(3 * time.Hour)}},
+		DepartureTime: now.Add(time.Hour), ArrivalTime: now.Add(4 * time.Hour),
+	}
+	if err := rideMgr.OfferRide(ride); err != nil {
+		t.Fatalf("Error offering ride: %v", err)
+	}
+	return rideMgr, rideStorage, now
+}
+
+// Test offering rides with stops
+func TestOfferMultiStopRide(t *testing.T) {
+	rideMgr, rideStorage, now := newMultiStopFixture(t)
+
+	ride, _ := rideStorage.GetRideByID("1")
+	if fmt.Sprint(ride.Route()) != "[A B C D]" || fmt.Sprint(ride.SegmentSeats) != "[2 2 2]" {
+		t.Fatalf("Expected route [A B C D] with 2 seats per segment, but got %v %v", ride.Route(), ride.SegmentSeats)
+	}
+
+	_ = rideMgr.userMgr.AddUser(User{ID: "2", Name: "Driver2", Role: Driver})
+	_ = rideMgr.vehicleMgr.AddVehicle(Vehicle{ID: "2", OwnerID: "2", Model: "XUV", Capacity: 7})
+	at := func(hours int) time.Time { return now.Add(time.Duration(hours) * time.Hour) }
+	invalid := []Ride{
+		{Source: "A", Destination: "D", Stops: []Waypoint{{Place: "B"}, {Place: "A"}}},
+		{Source: "A", Destination: "D", Stops: []Waypoint{{Place: ""}}},
+		{Source: "A", Destination: "D", Stops: []Waypoint{{Place: "B", Time: at(1)}}},
+		{Source: "A", Destination: "D", Stops: []Waypoint{{Place: "B", Time: at(3)}, {Place: "C", Time: at(2)}}, DepartureTime: at(1), ArrivalTime: at(4)},
+		{Source: "A", Destination: "D", Stops: []Waypoint{{Place: "B", Time: at(5)}}, DepartureTime: at(1), ArrivalTime: at(4)},
+	}
+	for i, ride := range invalid {
+		ride.ID, ride.DriverID, ride.VehicleID, ride.AvailableSeats = fmt.Sprint("bad", i), "2", "2", 1
+		if err := rideMgr.OfferRide(ride); err == nil {
+			t.Fatalf("Expected error offering %+v, but got none", ride)
+		}
+	}
+}
+
+// Test that passengers can board and alight at any stop
+func TestMultiStopSearch(t *testing.T) {
+	rideMgr, _, now := newMultiStopFixture(t)
+
+	rides := rideMgr.GetDirectRides("B", "D", TimeWindow{})
+	if len(rides) != 1 {
+		t.Fatalf("Expected 1 ride from B to D, but got %d", len(rides))
+	}
+	segment := rides[0]
+	if segment.Source != "B" || segment.Destination != "D" || fmt.Sprint(segment.Route()) != "[B C D]" {
+		t.Fatalf("Expected the B to D part of the ride, but got %+v", segment)
+	}
+	if !segment.DepartureTime.Equal(now.Add(2*time.Hour)) || !segment.ArrivalTime.Equal(now.Add(4*time.Hour)) {
+		t.Fatalf("Expected the segment to run from B's stop time to arrival, but got %v to %v", segment.DepartureTime, segment.ArrivalTime)
+	}
+	if rides := rideMgr.GetDirectRides("C", "B", TimeWindow{}); len(rides) != 0 {
+		t.Fatalf("Expected no rides travelling backwards, but got %+v", rides)
+	}
+	if rides := rideMgr.GetRidesBySource("C"); len(rides) != 1 {
+		t.Fatalf("Expected the ride to board at C, but got %+v", rides)
+	}
+	if rides := rideMgr.GetRidesBySource("D"); len(rides) != 0 {
+		t.Fatalf("Expected no boarding at the destination, but got %+v", rides)
+	}
+	window := TimeWindow{From: now.Add(90 * time.Minute), To: now.Add(150 * time.Minute)}
+	if rides := rideMgr.GetDirectRides("B", "C", window); len(rides) != 1 {
+		t.Fatalf("Expected the window to apply to the boarding stop, but got %+v", rides)
+	}
+}
+
+// Test that a seat freed at a stop can be sold again from there
+func TestMultiStopSeatsPerSegment(t *testing.T) {
+	rideMgr, rideStorage, _ := newMultiStopFixture(t)
+
+	first, err := rideMgr.SelectRide("p1", "A", "B", 2, string(MostVacantSeats))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if leg := first.Legs[0]; leg.Source != "A" || leg.Destination != "B" || leg.AvailableSeats != 0 {
+		t.Fatalf("Expected the booking to hold the A to B segment, but got %+v", leg)
+	}
+	second, err := rideMgr.SelectRide("p2", "B", "D", 2, string(MostVacantSeats))
+	if err != nil {
+		t.Fatalf("Expected seats freed at B to be sold again, but got %v", err)
+	}
+	if _, err := rideMgr.SelectRide("p3", "A", "C", 1, string(MostVacantSeats)); err == nil {
+		t.Fatalf("Expected no seats from A to C")
+	}
+
+	ride, _ := rideStorage.GetRideByID("1")
+	if fmt.Sprint(ride.SegmentSeats) != "[0 0 0]" || ride.AvailableSeats != 0 {
+		t.Fatalf("Expected every segment full, but got %v", ride.SegmentSeats)
+	}
+
+	if err := rideMgr.CancelBooking(second.ID, "plans changed"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	ride, _ = rideStorage.GetRideByID("1")
+	if fmt.Sprint(ride.SegmentSeats) != "[0 2 2]" || ride.AvailableSeats != 0 {
+		t.Fatalf("Expected seats back on B to D only, but got %v", ride.SegmentSeats)
+	}
+	if err := rideMgr.CancelBooking(first.ID, "plans changed"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	ride, _ = rideStorage.GetRideByID("1")
+	if fmt.Sprint(ride.SegmentSeats) != "[2 2 2]" || ride.AvailableSeats != 2 {
+		t.Fatalf("Expected all seats back, but got %v", ride.SegmentSeats)
+	}
+}
+
+// Test that indirect routes can use part of a multi-stop ride and only need
+// seats on the segments they travel
+func TestIndirectRouteUsesRideSegments(t *testing.T) {
+	rideMgr, rideStorage, now := newMultiStopFixture(t)
+	_ = rideMgr.userMgr.AddUser(User{ID: "2", Name: "Driver2", Role: Driver})
+	_ = rideMgr.vehicleMgr.AddVehicle(Vehicle{ID: "2", OwnerID: "2", Model: "XUV", Capacity: 7})
+	connecting := Ride{ID: "2", DriverID: "2", VehicleID: "2", Source: "C", Destination: "E", AvailableSeats: 3,
+		DepartureTime: now.Add(210 * time.Minute), ArrivalTime: now.Add(5 * time.Hour)}
+	if err := rideMgr.OfferRide(connecting); err != nil {
+		t.Fatalf("Error offering ride: %v", err)
+	}
+
+	// Fill A to B so the ride has no seats end to end.
+	if _, err := rideMgr.SelectRide("p1", "A", "B", 2, string(MostVacantSeats)); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	itineraries, err := rideMgr.SearchItineraries("B", "E", 2, 3, RouteOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(itineraries) != 1 {
+		t.Fatalf("Expected 1 itinerary, but got %d", len(itineraries))
+	}
+	it := itineraries[0]
+	if first := it.Legs[0].Ride; first.ID != "1" || first.Source != "B" || first.Destination != "C" {
+		t.Fatalf("Expected to ride 1 from B to C, but got %+v", first)
+	}
+	if it.AvailableSeats != 2 || it.Transfers[0].Wait != 30*time.Minute {
+		t.Fatalf("Expected 2 seats and a 30m wait at C, but got %d and %v", it.AvailableSeats, it.Transfers[0].Wait)
+	}
+	if got := fmt.Sprint(it.Legs[0].Segments); got != "[{A B 0} {B C 2} {C D 2}]" {
+		t.Fatalf("Expected the leg to show seats on every segment of ride 1, but got %s", got)
+	}
+
+	booking, err := rideMgr.BookItinerary("p2", it.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	ride, _ := rideStorage.GetRideByID("1")
+	expected := "[{A B 0} {B C 0} {C D 2}]"
+	if got := fmt.Sprint(ride.Availability()); got != expected {
+		t.Fatalf("Expected availability %s, but got %s", expected, got)
+	}
+	if _, err := rideMgr.FindRoute("B", "E", 1, RouteOptions{}); err == nil {
+		t.Fatalf("Expected no route once B to C is full")
+	}
+
+	if err := rideMgr.CancelBooking(booking.ID, "plans changed"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	ride, _ = rideStorage.GetRideByID("1")
+	if got := fmt.Sprint(ride.Availability()); got != "[{A B 0} {B C 2} {C D 2}]" {
+		t.Fatalf("Expected seats back on B to D, but got %s", got)
+	}
+}